@@ -0,0 +1,546 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/containerd/console"
+	eventstypes "github.com/containerd/containerd/api/events"
+	taskAPI "github.com/containerd/containerd/api/runtime/task/v2"
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/pkg/shutdown"
+	"github.com/containerd/containerd/pkg/stdio"
+	"github.com/containerd/containerd/protobuf"
+	ptypes "github.com/containerd/containerd/protobuf/types"
+	"github.com/containerd/containerd/runtime/v2/runc"
+	runcTask "github.com/containerd/containerd/runtime/v2/runc/task"
+	"github.com/containerd/containerd/runtime/v2/shim"
+	"github.com/containerd/containerd/sys/reaper"
+	runcC "github.com/containerd/go-runc"
+	"github.com/containerd/ttrpc"
+	"github.com/containerd/typeurl/v2"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urunc-dev/urunc/internal/config"
+	"github.com/urunc-dev/urunc/pkg/unikontainers"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	_     = (taskAPI.TaskService)(&service{})
+	empty = &ptypes.Empty{}
+
+	errNotSupported = errors.New("not supported by unikernels")
+)
+
+// service is the task service of the shim. Unikernels are handled by the
+// shim itself, while the rest of the containers (e.g. the pause container of
+// a pod) get handed to the task service of the runc shim.
+type service struct {
+	mu sync.Mutex
+
+	context  context.Context
+	events   chan interface{}
+	platform stdio.Platform
+	ec       chan runcC.Exit
+	shutdown shutdown.Service
+	runc     taskAPI.TaskService
+
+	unikernels map[string]*unikernel
+}
+
+// newTaskService creates the task service of the shim
+func newTaskService(ctx context.Context, publisher shim.Publisher, sd shutdown.Service) (taskAPI.TaskService, error) {
+	c, err := config.Load(config.DefaultPath)
+	if err != nil {
+		return nil, err
+	}
+	config.Set(c)
+	// The runc task service sets up the reaper and removes the socket of
+	// the shim on shutdown
+	runcService, err := runcTask.NewTaskService(ctx, publisher, sd)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := runc.NewPlatform()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize platform behavior: %w", err)
+	}
+	s := &service{
+		context:    ctx,
+		events:     make(chan interface{}, 128),
+		platform:   platform,
+		ec:         reaper.Default.Subscribe(),
+		shutdown:   sd,
+		runc:       runcService,
+		unikernels: make(map[string]*unikernel),
+	}
+	go s.processExits()
+	go s.forward(ctx, publisher)
+	sd.RegisterCallback(func(context.Context) error {
+		close(s.events)
+		return s.platform.Close()
+	})
+	return s, nil
+}
+
+func (s *service) RegisterTTRPC(server *ttrpc.Server) error {
+	taskAPI.RegisterTaskService(server, s)
+	return nil
+}
+
+// getUnikernel returns the unikernel task with the given id or nil, if the
+// task is not a unikernel
+func (s *service) getUnikernel(id string) *unikernel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unikernels[id]
+}
+
+// Create a new unikernel task or hand the container to runc
+func (s *service) Create(ctx context.Context, r *taskAPI.CreateTaskRequest) (_ *taskAPI.CreateTaskResponse, retErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The config of the unikernel might be in the rootfs
+	rootfs, err := mountRootfs(r)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	defer func() {
+		if retErr != nil && rootfs != "" {
+			if err := mount.UnmountRecursive(rootfs, 0); err != nil {
+				logrus.WithError(err).Warn("failed to cleanup rootfs mount")
+			}
+		}
+	}()
+	if !unikontainers.IsUnikernel(r.Bundle) {
+		if rootfs != "" {
+			err = mount.UnmountRecursive(rootfs, 0)
+			if err != nil {
+				return nil, errdefs.ToGRPC(err)
+			}
+			rootfs = ""
+		}
+		return s.runc.Create(ctx, r)
+	}
+
+	k, err := newUnikernel(ctx, s.platform, r, rootfs)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.unikernels[r.ID] = k
+
+	s.send(&eventstypes.TaskCreate{
+		ContainerID: r.ID,
+		Bundle:      r.Bundle,
+		Rootfs:      r.Rootfs,
+		IO: &eventstypes.TaskIO{
+			Stdin:    r.Stdin,
+			Stdout:   r.Stdout,
+			Stderr:   r.Stderr,
+			Terminal: r.Terminal,
+		},
+		Pid: uint32(k.init.Pid()),
+	})
+	return &taskAPI.CreateTaskResponse{
+		Pid: uint32(k.init.Pid()),
+	}, nil
+}
+
+// Start the monitor of a unikernel and boot the VM
+func (s *service) Start(ctx context.Context, r *taskAPI.StartRequest) (*taskAPI.StartResponse, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Start(ctx, r)
+	}
+	if r.ExecID != "" {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotImplemented, "exec: %v", errNotSupported)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.exited() {
+		return nil, errdefs.ToGRPCf(errdefs.ErrFailedPrecondition, "unikernel %s has exited", r.ID)
+	}
+	u, err := k.unikontainer()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	u.StartTrace("start", u.TraceContext(), time.Now())
+	err = u.Start()
+	if err == nil {
+		err = u.ExecuteHooks("Poststart")
+	}
+	u.EndTrace(err)
+	// Do not hold the start of the task, until the reexec process
+	// records its spans
+	go u.ExportTrace(true)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.send(&eventstypes.TaskStart{
+		ContainerID: r.ID,
+		Pid:         uint32(k.init.Pid()),
+	})
+	return &taskAPI.StartResponse{
+		Pid: uint32(k.init.Pid()),
+	}, nil
+}
+
+// Delete a unikernel task, once its monitor has exited
+func (s *service) Delete(ctx context.Context, r *taskAPI.DeleteRequest) (*taskAPI.DeleteResponse, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Delete(ctx, r)
+	}
+	if r.ExecID != "" {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "process %s", r.ExecID)
+	}
+	switch k.status() {
+	case task.Status_RUNNING, task.Status_PAUSED:
+		return nil, errdefs.ToGRPCf(errdefs.ErrFailedPrecondition, "cannot delete running unikernel %s", r.ID)
+	}
+	err := k.init.Delete(ctx)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.mu.Lock()
+	delete(s.unikernels, r.ID)
+	s.mu.Unlock()
+
+	p := k.init
+	s.send(&eventstypes.TaskDelete{
+		ContainerID: r.ID,
+		Pid:         uint32(p.Pid()),
+		ExitStatus:  uint32(p.ExitStatus()),
+		ExitedAt:    protobuf.ToTimestamp(p.ExitedAt()),
+	})
+	return &taskAPI.DeleteResponse{
+		ExitStatus: uint32(p.ExitStatus()),
+		ExitedAt:   protobuf.ToTimestamp(p.ExitedAt()),
+		Pid:        uint32(p.Pid()),
+	}, nil
+}
+
+// Exec is not supported by unikernels, since there is no process to join
+func (s *service) Exec(ctx context.Context, r *taskAPI.ExecProcessRequest) (*ptypes.Empty, error) {
+	if s.getUnikernel(r.ID) == nil {
+		return s.runc.Exec(ctx, r)
+	}
+	return nil, errdefs.ToGRPCf(errdefs.ErrNotImplemented, "exec: %v", errNotSupported)
+}
+
+// ResizePty of the console of a unikernel
+func (s *service) ResizePty(ctx context.Context, r *taskAPI.ResizePtyRequest) (*ptypes.Empty, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.ResizePty(ctx, r)
+	}
+	if r.ExecID != "" {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "process %s", r.ExecID)
+	}
+	ws := console.WinSize{
+		Width:  uint16(r.Width),  // nolint:gosec
+		Height: uint16(r.Height), // nolint:gosec
+	}
+	err := k.init.Resize(ws)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	return empty, nil
+}
+
+// State returns runtime state information for a unikernel
+func (s *service) State(ctx context.Context, r *taskAPI.StateRequest) (*taskAPI.StateResponse, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.State(ctx, r)
+	}
+	if r.ExecID != "" {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "process %s", r.ExecID)
+	}
+	p := k.init
+	sio := p.Stdio()
+	return &taskAPI.StateResponse{
+		ID:         p.ID(),
+		Bundle:     k.bundle,
+		Pid:        uint32(p.Pid()),
+		Status:     k.status(),
+		Stdin:      sio.Stdin,
+		Stdout:     sio.Stdout,
+		Stderr:     sio.Stderr,
+		Terminal:   sio.Terminal,
+		ExitStatus: uint32(p.ExitStatus()),
+		ExitedAt:   protobuf.ToTimestamp(p.ExitedAt()),
+	}, nil
+}
+
+// Pause the VM of a unikernel
+func (s *service) Pause(ctx context.Context, r *taskAPI.PauseRequest) (*ptypes.Empty, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Pause(ctx, r)
+	}
+	u, err := k.unikontainer()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	err = u.Pause()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.send(&eventstypes.TaskPaused{
+		ContainerID: r.ID,
+	})
+	return empty, nil
+}
+
+// Resume the VM of a unikernel
+func (s *service) Resume(ctx context.Context, r *taskAPI.ResumeRequest) (*ptypes.Empty, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Resume(ctx, r)
+	}
+	u, err := k.unikontainer()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	err = u.Resume()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	s.send(&eventstypes.TaskResumed{
+		ContainerID: r.ID,
+	})
+	return empty, nil
+}
+
+// Kill the monitor of a unikernel with the provided signal. SIGTERM shuts
+// down the guest gracefully.
+func (s *service) Kill(ctx context.Context, r *taskAPI.KillRequest) (*ptypes.Empty, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Kill(ctx, r)
+	}
+	if r.ExecID != "" {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "process %s", r.ExecID)
+	}
+	if k.exited() {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "unikernel %s has exited", r.ID)
+	}
+	u, err := k.unikontainer()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	err = u.Kill(unix.Signal(r.Signal))
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	return empty, nil
+}
+
+// Pids returns the pid of the monitor, the only process of a unikernel
+func (s *service) Pids(ctx context.Context, r *taskAPI.PidsRequest) (*taskAPI.PidsResponse, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Pids(ctx, r)
+	}
+	var processes []*task.ProcessInfo
+	if !k.exited() {
+		processes = append(processes, &task.ProcessInfo{Pid: uint32(k.init.Pid())})
+	}
+	return &taskAPI.PidsResponse{
+		Processes: processes,
+	}, nil
+}
+
+// CloseIO closes the stdin of a unikernel
+func (s *service) CloseIO(ctx context.Context, r *taskAPI.CloseIORequest) (*ptypes.Empty, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.CloseIO(ctx, r)
+	}
+	if r.ExecID != "" {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "process %s", r.ExecID)
+	}
+	if stdin := k.init.Stdin(); stdin != nil {
+		err := stdin.Close()
+		if err != nil {
+			return nil, fmt.Errorf("close stdin: %w", err)
+		}
+	}
+	return empty, nil
+}
+
+// Checkpoint is not supported by unikernels
+func (s *service) Checkpoint(ctx context.Context, r *taskAPI.CheckpointTaskRequest) (*ptypes.Empty, error) {
+	if s.getUnikernel(r.ID) == nil {
+		return s.runc.Checkpoint(ctx, r)
+	}
+	return nil, errdefs.ToGRPCf(errdefs.ErrNotImplemented, "checkpoint: %v", errNotSupported)
+}
+
+// Update the resources of a running unikernel
+func (s *service) Update(ctx context.Context, r *taskAPI.UpdateTaskRequest) (*ptypes.Empty, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Update(ctx, r)
+	}
+	var resources specs.LinuxResources
+	err := json.Unmarshal(r.Resources.GetValue(), &resources)
+	if err != nil {
+		return nil, errdefs.ToGRPCf(errdefs.ErrInvalidArgument, "invalid resources: %v", err)
+	}
+	u, err := k.unikontainer()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	err = u.Update(&resources)
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	return empty, nil
+}
+
+// Wait for the monitor of a unikernel to exit
+func (s *service) Wait(ctx context.Context, r *taskAPI.WaitRequest) (*taskAPI.WaitResponse, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Wait(ctx, r)
+	}
+	if r.ExecID != "" {
+		return nil, errdefs.ToGRPCf(errdefs.ErrNotFound, "process %s", r.ExecID)
+	}
+	k.init.Wait()
+	return &taskAPI.WaitResponse{
+		ExitStatus: uint32(k.init.ExitStatus()),
+		ExitedAt:   protobuf.ToTimestamp(k.init.ExitedAt()),
+	}, nil
+}
+
+// Connect returns shim information such as the shim's pid
+func (s *service) Connect(ctx context.Context, r *taskAPI.ConnectRequest) (*taskAPI.ConnectResponse, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Connect(ctx, r)
+	}
+	return &taskAPI.ConnectResponse{
+		ShimPid: uint32(os.Getpid()),
+		TaskPid: uint32(k.init.Pid()),
+	}, nil
+}
+
+// Shutdown the shim, unless it still serves unikernels or containers
+func (s *service) Shutdown(ctx context.Context, r *taskAPI.ShutdownRequest) (*ptypes.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.unikernels) > 0 {
+		return empty, nil
+	}
+	return s.runc.Shutdown(ctx, r)
+}
+
+// Stats returns the resource usage of the VM of a unikernel
+func (s *service) Stats(ctx context.Context, r *taskAPI.StatsRequest) (*taskAPI.StatsResponse, error) {
+	k := s.getUnikernel(r.ID)
+	if k == nil {
+		return s.runc.Stats(ctx, r)
+	}
+	u, err := k.unikontainer()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	metrics, err := u.Metrics()
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	data, err := typeurl.MarshalAny(metrics)
+	if err != nil {
+		return nil, err
+	}
+	return &taskAPI.StatsResponse{
+		Stats: protobuf.FromAny(data),
+	}, nil
+}
+
+// processExits handles the exits of the monitors, as reported by the reaper.
+// The exits of any other process are handled by the runc task service.
+func (s *service) processExits() {
+	for e := range s.ec {
+		var exited *unikernel
+		s.mu.Lock()
+		for _, k := range s.unikernels {
+			if k.init.Pid() == e.Pid && !k.exited() {
+				exited = k
+				break
+			}
+		}
+		s.mu.Unlock()
+		if exited != nil {
+			s.handleExit(exited, e)
+		}
+	}
+}
+
+// handleExit records the exit status of the monitor, both for containerd
+// and for urunc
+func (s *service) handleExit(k *unikernel, e runcC.Exit) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.init.SetExited(e.Status)
+	u, err := k.unikontainer()
+	if err == nil {
+		ws := waitStatus(<-k.exit, e.Status)
+		err = u.SetStopped(&ws)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", k.id).Warn("failed to record the exit status of the monitor")
+	}
+	s.send(&eventstypes.TaskExit{
+		ContainerID: k.id,
+		ID:          k.id,
+		Pid:         uint32(e.Pid),
+		ExitStatus:  uint32(e.Status),
+		ExitedAt:    protobuf.ToTimestamp(k.init.ExitedAt()),
+	})
+}
+
+func (s *service) send(evt interface{}) {
+	s.events <- evt
+}
+
+// forward publishes the events of the unikernels. The runc task service
+// publishes its own events and closes the publisher.
+func (s *service) forward(ctx context.Context, publisher shim.Publisher) {
+	ns, _ := namespaces.Namespace(ctx)
+	ctx = namespaces.WithNamespace(context.Background(), ns)
+	for e := range s.events {
+		err := publisher.Publish(ctx, runc.GetTopic(e), e)
+		if err != nil {
+			logrus.WithError(err).Error("post event")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	taskAPI "github.com/containerd/containerd/api/runtime/task/v2"
+	"github.com/containerd/containerd/errdefs"
+	ptypes "github.com/containerd/containerd/protobuf/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunc records the requests handed to the runc task service. Any method
+// it does not implement panics through the nil embedded interface.
+type fakeRunc struct {
+	taskAPI.TaskService
+	calls []string
+}
+
+func (f *fakeRunc) State(_ context.Context, r *taskAPI.StateRequest) (*taskAPI.StateResponse, error) {
+	f.calls = append(f.calls, "State "+r.ID)
+	return &taskAPI.StateResponse{ID: r.ID}, nil
+}
+
+func (f *fakeRunc) Kill(_ context.Context, r *taskAPI.KillRequest) (*ptypes.Empty, error) {
+	f.calls = append(f.calls, "Kill "+r.ID)
+	return empty, nil
+}
+
+func (f *fakeRunc) Exec(_ context.Context, r *taskAPI.ExecProcessRequest) (*ptypes.Empty, error) {
+	f.calls = append(f.calls, "Exec "+r.ID)
+	return empty, nil
+}
+
+func (f *fakeRunc) Checkpoint(_ context.Context, r *taskAPI.CheckpointTaskRequest) (*ptypes.Empty, error) {
+	f.calls = append(f.calls, "Checkpoint "+r.ID)
+	return empty, nil
+}
+
+func (f *fakeRunc) Shutdown(_ context.Context, _ *taskAPI.ShutdownRequest) (*ptypes.Empty, error) {
+	f.calls = append(f.calls, "Shutdown")
+	return empty, nil
+}
+
+func newTestService() (*service, *fakeRunc) {
+	runc := &fakeRunc{}
+	return &service{
+		runc:       runc,
+		unikernels: map[string]*unikernel{"uk": {id: "uk"}},
+	}, runc
+}
+
+func TestServiceForwardsContainers(t *testing.T) {
+	s, runc := newTestService()
+	ctx := context.Background()
+
+	state, err := s.State(ctx, &taskAPI.StateRequest{ID: "pause"})
+	assert.NoError(t, err)
+	assert.Equal(t, "pause", state.ID)
+	_, err = s.Kill(ctx, &taskAPI.KillRequest{ID: "pause", Signal: 9})
+	assert.NoError(t, err)
+	_, err = s.Exec(ctx, &taskAPI.ExecProcessRequest{ID: "pause", ExecID: "sh"})
+	assert.NoError(t, err)
+	_, err = s.Checkpoint(ctx, &taskAPI.CheckpointTaskRequest{ID: "pause"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"State pause", "Kill pause", "Exec pause", "Checkpoint pause"}, runc.calls)
+}
+
+func TestServiceUnsupported(t *testing.T) {
+	s, runc := newTestService()
+	ctx := context.Background()
+
+	_, err := s.Exec(ctx, &taskAPI.ExecProcessRequest{ID: "uk", ExecID: "sh"})
+	assert.ErrorIs(t, errdefs.FromGRPC(err), errdefs.ErrNotImplemented)
+	_, err = s.Checkpoint(ctx, &taskAPI.CheckpointTaskRequest{ID: "uk"})
+	assert.ErrorIs(t, errdefs.FromGRPC(err), errdefs.ErrNotImplemented)
+	_, err = s.State(ctx, &taskAPI.StateRequest{ID: "uk", ExecID: "sh"})
+	assert.ErrorIs(t, errdefs.FromGRPC(err), errdefs.ErrNotFound)
+	assert.Empty(t, runc.calls)
+}
+
+func TestServiceShutdown(t *testing.T) {
+	s, runc := newTestService()
+	ctx := context.Background()
+
+	// The shim keeps serving its unikernels
+	_, err := s.Shutdown(ctx, &taskAPI.ShutdownRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, runc.calls)
+
+	delete(s.unikernels, "uk")
+	_, err = s.Shutdown(ctx, &taskAPI.ShutdownRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Shutdown"}, runc.calls)
+}
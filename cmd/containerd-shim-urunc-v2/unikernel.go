@@ -0,0 +1,218 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	taskAPI "github.com/containerd/containerd/api/runtime/task/v2"
+	"github.com/containerd/containerd/api/types/runc/options"
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/pkg/process"
+	"github.com/containerd/containerd/pkg/stdio"
+	"github.com/containerd/containerd/runtime/v2/runc"
+	"github.com/containerd/typeurl/v2"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urunc-dev/urunc/pkg/unikontainers"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/hypervisors"
+	"golang.org/x/sys/unix"
+)
+
+// unikernel is a task, which runs a unikernel. The urunc binary creates and
+// deletes it, as it does for runc, since the monitor gets spawned by the
+// reexec of urunc create. Everything else is done by the shim itself, through
+// the unikontainers package.
+type unikernel struct {
+	// mu serializes the start of the task with the handling of its exit, so
+	// the exit event never gets published before the start event
+	mu     sync.Mutex
+	id     string
+	bundle string
+	init   *process.Init
+	// exit receives the wait status of the monitor, once it exits
+	exit <-chan *unix.WaitStatus
+}
+
+// mountRootfs mounts the rootfs of the task in the bundle and returns its path,
+// or an empty path if the request has no rootfs mounts
+func mountRootfs(r *taskAPI.CreateTaskRequest) (string, error) {
+	if len(r.Rootfs) == 0 {
+		return "", nil
+	}
+	rootfs := filepath.Join(r.Bundle, "rootfs")
+	err := os.Mkdir(rootfs, 0o711)
+	if err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	var mounts []mount.Mount
+	for _, m := range r.Rootfs {
+		mounts = append(mounts, mount.Mount{
+			Type:    m.Type,
+			Source:  m.Source,
+			Target:  m.Target,
+			Options: m.Options,
+		})
+	}
+	err = mount.All(mounts, rootfs)
+	if err != nil {
+		_ = mount.UnmountMounts(mounts, rootfs, 0)
+		return "", fmt.Errorf("failed to mount rootfs component: %w", err)
+	}
+	return rootfs, nil
+}
+
+// newUnikernel creates the unikernel task, with urunc create. The rootfs
+// should be already mounted.
+func newUnikernel(ctx context.Context, platform stdio.Platform, r *taskAPI.CreateTaskRequest, rootfs string) (*unikernel, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create namespace: %w", err)
+	}
+	if r.Checkpoint != "" {
+		return nil, fmt.Errorf("unikernels can not be restored from a checkpoint: %w", errNotSupported)
+	}
+	opts := &options.Options{}
+	if r.Options.GetValue() != nil {
+		v, err := typeurl.UnmarshalAny(r.Options)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			opts = v.(*options.Options)
+		}
+	}
+	// The manager of the shim reads them to clean up after a crash
+	err = runc.WriteOptions(r.Bundle, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = runc.WriteRuntime(r.Bundle, opts.BinaryName)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := process.NewRunc(opts.Root, r.Bundle, ns, opts.BinaryName, opts.SystemdCgroup)
+	p := process.New(r.ID, runtime, stdio.Stdio{
+		Stdin:    r.Stdin,
+		Stdout:   r.Stdout,
+		Stderr:   r.Stderr,
+		Terminal: r.Terminal,
+	})
+	p.Bundle = r.Bundle
+	p.Platform = platform
+	p.Rootfs = rootfs
+	p.WorkDir = filepath.Join(r.Bundle, "work")
+	p.IoUID = int(opts.IoUid)
+	p.IoGID = int(opts.IoGid)
+	p.NoPivotRoot = opts.NoPivotRoot
+	p.NoNewKeyring = opts.NoNewKeyring
+	p.CriuWorkPath = p.WorkDir
+	err = p.Create(ctx, &process.CreateConfig{
+		ID:       r.ID,
+		Bundle:   r.Bundle,
+		Runtime:  opts.BinaryName,
+		Terminal: r.Terminal,
+		Stdin:    r.Stdin,
+		Stdout:   r.Stdout,
+		Stderr:   r.Stderr,
+		Options:  r.Options,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &unikernel{
+		id:     r.ID,
+		bundle: r.Bundle,
+		init:   p,
+		exit:   watchExit(p.Pid()),
+	}, nil
+}
+
+// unikontainer loads the current state of the unikernel from the state
+// directory of urunc
+func (k *unikernel) unikontainer() (*unikontainers.Unikontainer, error) {
+	return unikontainers.Get(k.id, k.init.Runtime().Root)
+}
+
+// exited returns whether the shim has reaped the monitor
+func (k *unikernel) exited() bool {
+	return !k.init.ExitedAt().IsZero()
+}
+
+// status returns the status of the task. Once the monitor gets reaped, the
+// task is stopped. Until then, urunc knows better.
+func (k *unikernel) status() task.Status {
+	if k.exited() {
+		return task.Status_STOPPED
+	}
+	u, err := k.unikontainer()
+	if err != nil {
+		return task.Status_UNKNOWN
+	}
+	switch u.Status() {
+	case specs.StateCreated:
+		return task.Status_CREATED
+	case specs.StateRunning:
+		return task.Status_RUNNING
+	case unikontainers.StatePaused:
+		return task.Status_PAUSED
+	case specs.StateStopped:
+		return task.Status_STOPPED
+	default:
+		return task.Status_UNKNOWN
+	}
+}
+
+// watchExit waits for the process with the given pid to exit, without
+// reaping it, and sends its wait status, as found in /proc/<pid>/stat. The
+// reaper only reports an exit code, which can not tell a process killed by
+// a signal apart from one that exited with 128 plus the signal. If the
+// reaper reaps the process first, nil is sent.
+func watchExit(pid int) <-chan *unix.WaitStatus {
+	ch := make(chan *unix.WaitStatus, 1)
+	go func() {
+		var info unix.Siginfo
+		var err error
+		for {
+			err = unix.Waitid(unix.P_PID, pid, &info, unix.WEXITED|unix.WNOWAIT, nil)
+			if !errors.Is(err, unix.EINTR) {
+				break
+			}
+		}
+		if err != nil {
+			ch <- nil
+			return
+		}
+		_, ws := hypervisors.ProcessExited(pid)
+		ch <- ws
+	}()
+	return ch
+}
+
+// waitStatus returns the wait status of an exited monitor. Without the real
+// wait status, the exit code reported by the reaper is all we know.
+func waitStatus(ws *unix.WaitStatus, status int) unix.WaitStatus {
+	if ws != nil {
+		return *ws
+	}
+	return unix.WaitStatus((status & 0xff) << 8)
+}
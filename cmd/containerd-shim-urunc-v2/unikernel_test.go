@@ -0,0 +1,76 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// exitOf runs cmd, calls kill on it, if it is not nil, and returns the wait
+// status sent by watchExit
+func exitOf(t *testing.T, cmd *exec.Cmd, kill func(pid int)) *unix.WaitStatus {
+	require.NoError(t, cmd.Start())
+	exit := watchExit(cmd.Process.Pid)
+	if kill != nil {
+		kill(cmd.Process.Pid)
+	}
+	var ws *unix.WaitStatus
+	select {
+	case ws = <-exit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchExit did not notice the exit")
+	}
+	// watchExit must leave the process for the reaper
+	_ = cmd.Wait()
+	require.NotNil(t, ws)
+	return ws
+}
+
+func TestWatchExit(t *testing.T) {
+	ws := exitOf(t, exec.Command("sh", "-c", "exit 137"), nil)
+	assert.True(t, ws.Exited())
+	assert.Equal(t, 137, ws.ExitStatus())
+
+	ws = exitOf(t, exec.Command("sleep", "10"), func(pid int) {
+		assert.NoError(t, unix.Kill(pid, unix.SIGKILL))
+	})
+	assert.True(t, ws.Signaled())
+	assert.Equal(t, unix.SIGKILL, ws.Signal())
+
+	// Not a child of ours
+	assert.Nil(t, <-watchExit(1))
+}
+
+func TestWaitStatus(t *testing.T) {
+	killed := unix.WaitStatus(unix.SIGKILL)
+	ws := waitStatus(&killed, 137)
+	assert.True(t, ws.Signaled())
+	assert.Equal(t, unix.SIGKILL, ws.Signal())
+
+	// Without the real wait status, an exit code above 128 is not a signal
+	ws = waitStatus(nil, 137)
+	assert.True(t, ws.Exited())
+	assert.Equal(t, 137, ws.ExitStatus())
+
+	ws = waitStatus(nil, 0)
+	assert.True(t, ws.Exited())
+	assert.Zero(t, ws.ExitStatus())
+}
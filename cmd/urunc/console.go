@@ -0,0 +1,76 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/urunc-dev/urunc/pkg/unikontainers"
+)
+
+var consoleCommand = cli.Command{
+	Name:  "console",
+	Usage: "attach to the guest console of a running container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The console command attaches the terminal to the guest console of a
+unikernel. The console is available with the --console-attach global option or
+the com.urunc.runtime.consoleAttach annotation. Many consoles can be attached
+to the same container, but only one of them can write to the guest. Enter the
+detach keys sequence to detach from the guest console.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "read-only",
+			Usage: "only read the guest console",
+		},
+		cli.StringFlag{
+			Name:  "detach-keys",
+			Value: unikontainers.DefaultDetachKeys,
+			Usage: "key sequence for detaching from the guest console",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "CONSOLE").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		detachKeys, err := unikontainers.ParseDetachKeys(context.String("detach-keys"))
+		if err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		socketPath := unikontainer.ConsoleSocketPath()
+		if !unikontainers.SockAddrExists(socketPath) {
+			return fmt.Errorf("the console of %s is not available", unikontainer.State.ID)
+		}
+
+		restore, err := unikontainers.SetRawTerminal(int(os.Stdin.Fd()))
+		if err == nil {
+			defer func() {
+				_ = restore()
+			}()
+		}
+		return unikontainers.AttachConsole(socketPath, os.Stdin, os.Stdout, context.Bool("read-only"), detachKeys)
+	},
+}
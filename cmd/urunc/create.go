@@ -24,10 +24,13 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/urunc-dev/urunc/internal/tracing"
 	"github.com/urunc-dev/urunc/pkg/unikontainers"
 	"golang.org/x/sys/unix"
 )
@@ -93,6 +96,7 @@ func createUnikontainer(context *cli.Context) (err error) {
 		return err
 	}
 	metrics.Capture(containerID, "TS00")
+	started := time.Now()
 
 	// We have already made sure in main.go that root is not nil
 	rootDir := context.GlobalString("root")
@@ -124,6 +128,11 @@ func createUnikontainer(context *cli.Context) (err error) {
 	if err != nil {
 		return err
 	}
+	// The trace of the container might continue the one of the caller
+	unikontainer.StartTrace("create", tracing.FromEnv(), started)
+	defer func() {
+		unikontainer.EndTrace(err)
+	}()
 
 	metrics.Capture(containerID, "TS02")
 
@@ -158,6 +167,9 @@ func createUnikontainer(context *cli.Context) (err error) {
 
 	// Setup reexecCommand
 	reexecCommand := createReexecCmd(initSockChild, logPipeChild)
+	if spanContext := unikontainer.SpanContext(); spanContext.IsValid() {
+		reexecCommand.Env = append(reexecCommand.Env, tracing.TraceparentEnv+"="+spanContext.Traceparent())
+	}
 
 	// Create a go func to handle logs from nsenter
 	logsDone := ForwardLogs(logPipeParent)
@@ -170,13 +182,50 @@ func createUnikontainer(context *cli.Context) (err error) {
 	// The main concern is the nsenter execution before the reexec.
 	// If anythong goes wrong and we mess up with nsenter debugging
 	// is extremely hard.
+	consoleLog, consoleLogSize := unikontainer.ConsoleLog(context.GlobalBool("console-log"))
+	loggerConfig := consoleLoggerConfig{
+		terminal: unikontainer.Spec.Process.Terminal,
+		log:      consoleLog,
+		logSize:  consoleLogSize,
+		attach:   unikontainer.ConsoleAttach(context.GlobalBool("console-attach")),
+	}
+	withLogger := loggerConfig.log || loggerConfig.attach
 	if unikontainer.Spec.Process.Terminal {
-		ptm, err := pty.Start(reexecCommand)
+		ptm, pts, err := pty.Open()
 		if err != nil {
-			err = fmt.Errorf("failed to setup pty and start reexec process: %w", err)
+			err = fmt.Errorf("failed to open pty: %w", err)
 			return err
 		}
 		defer ptm.Close()
+		if withLogger {
+			// The monitor gets its own pty and the console logger
+			// sits between the two
+			guestPtm, guestPts, err := pty.Open()
+			if err != nil {
+				pts.Close()
+				err = fmt.Errorf("failed to open pty: %w", err)
+				return err
+			}
+			err = startConsoleLogger(context, unikontainer, loggerConfig, pts, pts, []*os.File{guestPtm})
+			guestPtm.Close()
+			pts.Close()
+			if err != nil {
+				guestPts.Close()
+				return err
+			}
+			pts = guestPts
+		}
+		reexecCommand.Stdin = pts
+		reexecCommand.Stdout = pts
+		reexecCommand.Stderr = pts
+		// Make the pty the controlling terminal of the reexec process
+		reexecCommand.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+		err = reexecCommand.Start()
+		pts.Close()
+		if err != nil {
+			err = fmt.Errorf("failed to start reexec process: %w", err)
+			return err
+		}
 		consoleSocket := context.String("console-socket")
 		conn, err := net.Dial("unix", consoleSocket)
 		if err != nil {
@@ -203,6 +252,13 @@ func createUnikontainer(context *cli.Context) (err error) {
 		reexecCommand.Stdin = os.Stdin
 		reexecCommand.Stdout = os.Stdout
 		reexecCommand.Stderr = os.Stderr
+		if withLogger {
+			pipes, err := pipeConsoleLogger(context, unikontainer, loggerConfig, reexecCommand)
+			if err != nil {
+				return err
+			}
+			defer pipes.Close()
+		}
 		err := reexecCommand.Start()
 		if err != nil {
 			err = fmt.Errorf("failed to start reexec process: %w", err)
@@ -251,6 +307,16 @@ func createUnikontainer(context *cli.Context) (err error) {
 	containerPid := reexecPid
 	metrics.Capture(containerID, "TS06")
 
+	// Place the reexec process, which becomes the monitor, in the cgroup
+	// of the container before it starts the VM
+	err = unikontainer.SetupCgroup(containerPid, context.GlobalBool("systemd-cgroup"))
+	if err != nil {
+		// Do not leave the reexec process behind, which would also keep
+		// the cgroup busy when delete removes it
+		_ = syscall.Kill(containerPid, syscall.SIGKILL)
+		return err
+	}
+
 	err = unikontainer.Create(containerPid)
 	if err != nil {
 		return err
@@ -350,11 +416,12 @@ func handleNsenterRet(initSock *os.File, reexec *exec.Cmd) (int, error) {
 // waits AckReexec message on urunc.sock,
 // waits StartExecve message on urunc.sock,
 // executes Prestart hooks and finally execve's the unikernel vmm.
-func reexecUnikontainer(context *cli.Context) error {
+func reexecUnikontainer(context *cli.Context) (err error) {
 	// No need to check if containerID is valid, because it will get
 	// checked later. We just want it for the metrics
 	containerID := context.Args().First()
 	metrics.Capture(containerID, "TS04")
+	started := time.Now()
 
 	logFd, err := strconv.Atoi(os.Getenv("_LIBCONTAINER_LOGPIPE"))
 	if err != nil {
@@ -399,6 +466,12 @@ func reexecUnikontainer(context *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	// urunc create passes the context of its span in the environment. On
+	// success, the span ends right before the execve of the monitor.
+	unikontainer.StartTrace("reexec", tracing.FromEnv(), started)
+	defer func() {
+		unikontainer.EndTrace(err)
+	}()
 
 	// wait StartExecve message on urunc.sock from urunc start process
 	err = unikontainers.ListenAndAwaitMsg(socketPath, unikontainers.StartExecve)
@@ -414,5 +487,5 @@ func reexecUnikontainer(context *cli.Context) error {
 	}
 
 	// execve
-	return unikontainer.Exec()
+	return unikontainer.Exec(metrics)
 }
@@ -38,7 +38,7 @@ status of "ubuntu01" as "stopped" the following will delete resources held for
 	Flags: []cli.Flag{
 		cli.BoolFlag{
 			Name:  "force, f",
-			Usage: "Forcibly deletes the container if it is still running (uses SIGKILL)",
+			Usage: "Forcibly deletes the container if it is still running (shuts down the guest and falls back to SIGKILL)",
 		},
 	},
 	Action: func(context *cli.Context) error {
@@ -55,7 +55,7 @@ status of "ubuntu01" as "stopped" the following will delete resources held for
 			return err
 		}
 		if context.Bool("force") {
-			err := unikontainer.Kill()
+			err := unikontainer.Stop()
 			if err != nil {
 				return err
 			}
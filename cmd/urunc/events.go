@@ -0,0 +1,102 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opencontainers/runc/types"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var eventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "display container events such as OOM notifications and resource usage statistics",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The events command displays information about the container, in the
+format of runc events. The statistics include the CPU and memory usage of the
+VMM, the counters of the TAP devices and, if the VMM reports them, the
+statistics that the VMM keeps for the VM under "vm". By default, the statistics
+are displayed every 5 seconds, until the container stops.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: 5 * time.Second,
+			Usage: "set the stats collection interval",
+		},
+		cli.BoolFlag{
+			Name:  "stats",
+			Usage: "display the container's stats then exit",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "EVENTS").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		interval := context.Duration("interval")
+		if interval <= 0 {
+			return fmt.Errorf("duration interval must be greater than 0")
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		if context.Bool("stats") {
+			stats, err := unikontainer.Stats()
+			if err != nil {
+				return err
+			}
+			return encoder.Encode(types.Event{Type: "stats", ID: unikontainer.State.ID, Data: stats})
+		}
+
+		// Only the OOM kills after the first stats get reported
+		oomKills := uint64(0)
+		first := true
+		for {
+			stats, err := unikontainer.Stats()
+			switch {
+			case unikontainer.Status() == specs.StateStopped:
+				return nil
+			case err != nil:
+				logrus.WithError(err).Error("failed to retrieve the container's stats")
+			default:
+				if !first && stats.OOMKills > oomKills {
+					err = encoder.Encode(types.Event{Type: "oom", ID: unikontainer.State.ID})
+					if err != nil {
+						return err
+					}
+				}
+				oomKills = stats.OOMKills
+				first = false
+				err = encoder.Encode(types.Event{Type: "stats", ID: unikontainer.State.ID, Data: stats})
+				if err != nil {
+					return err
+				}
+			}
+			time.Sleep(interval)
+		}
+	},
+}
@@ -15,11 +15,15 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 var killCommand = cli.Command{
@@ -57,6 +61,41 @@ signal to the init process of the "ubuntu01" container:
 		if err != nil {
 			return err
 		}
-		return unikontainer.Kill()
+
+		sigstr := context.Args().Get(1)
+		if sigstr == "" {
+			sigstr = "SIGTERM"
+		}
+		signal, err := parseSignal(sigstr)
+		if err != nil {
+			return err
+		}
+		// The monitor is the only process inside a unikernel container,
+		// hence --all does not make any difference.
+		return unikontainer.Kill(signal)
 	},
 }
+
+// sigrtmax is the largest signal number on Linux (SIGRTMAX)
+const sigrtmax = 64
+
+// parseSignal converts a signal name (e.g. TERM, SIGTERM) or number
+// to the respective signal.
+func parseSignal(rawSignal string) (unix.Signal, error) {
+	s, err := strconv.Atoi(rawSignal)
+	if err == nil {
+		if s <= 0 || s > sigrtmax {
+			return -1, fmt.Errorf("invalid signal number %d", s)
+		}
+		return unix.Signal(s), nil
+	}
+	sig := strings.ToUpper(rawSignal)
+	if !strings.HasPrefix(sig, "SIG") {
+		sig = "SIG" + sig
+	}
+	signal := unix.SignalNum(sig)
+	if signal == 0 {
+		return -1, fmt.Errorf("unknown signal %q", rawSignal)
+	}
+	return signal, nil
+}
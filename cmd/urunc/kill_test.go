@@ -0,0 +1,53 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    unix.Signal
+		wantErr bool
+	}{
+		{raw: "9", want: unix.SIGKILL},
+		{raw: "1", want: unix.SIGHUP},
+		{raw: "64", want: unix.Signal(64)},
+		{raw: "TERM", want: unix.SIGTERM},
+		{raw: "sigterm", want: unix.SIGTERM},
+		{raw: "SIGUSR1", want: unix.SIGUSR1},
+		{raw: "0", wantErr: true},
+		{raw: "-9", wantErr: true},
+		{raw: "65", wantErr: true},
+		{raw: "SIGFOO", wantErr: true},
+		{raw: "", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.raw, func(t *testing.T) {
+			sig, err := parseSignal(tc.raw)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, sig)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/urunc-dev/urunc/pkg/unikontainers"
+)
+
+const formatOptions = `table or json`
+
+// containerSummary holds the information of a unikernel container
+// which gets printed by the list command
+type containerSummary struct {
+	ID         string    `json:"id"`
+	Pid        int       `json:"pid"`
+	Status     string    `json:"status"`
+	Bundle     string    `json:"bundle"`
+	Created    time.Time `json:"created"`
+	Unikernel  string    `json:"unikernelType"`
+	Hypervisor string    `json:"hypervisor"`
+}
+
+var listCommand = cli.Command{
+	Name:  "list",
+	Usage: "lists containers started by urunc with the given root",
+	ArgsUsage: `
+
+Where the given root is specified via the global option "--root"
+(default: "/run/urunc").
+
+EXAMPLE 1:
+To list containers created via the default "--root":
+       # urunc list
+
+EXAMPLE 2:
+To list containers created using a non-default value for "--root":
+       # urunc --root value list`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: `select one of: ` + formatOptions,
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "display only container IDs",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "LIST").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 0, exactArgs); err != nil {
+			return err
+		}
+
+		// We have already made sure in main.go that root is not nil
+		rootDir := context.GlobalString("root")
+		s, err := getContainers(rootDir)
+		if err != nil {
+			return err
+		}
+
+		if context.Bool("quiet") {
+			for _, item := range s {
+				fmt.Println(item.ID)
+			}
+			return nil
+		}
+
+		switch context.String("format") {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+			fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tUNIKERNEL\tHYPERVISOR\n")
+			for _, item := range s {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+					item.ID,
+					item.Pid,
+					item.Status,
+					item.Bundle,
+					item.Created.Format(time.RFC3339Nano),
+					item.Unikernel,
+					item.Hypervisor)
+			}
+			return w.Flush()
+		case "json":
+			return json.NewEncoder(os.Stdout).Encode(s)
+		default:
+			return fmt.Errorf("invalid format option: %s", context.String("format"))
+		}
+	},
+}
+
+// getContainers returns a summary of every unikernel container under rootDir
+func getContainers(rootDir string) ([]containerSummary, error) {
+	unikontainerList, err := unikontainers.List(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make([]containerSummary, 0, len(unikontainerList))
+	for _, u := range unikontainerList {
+		status := u.Status()
+		pid := u.State.Pid
+		// Similarly to runc, do not report the PID of a stopped
+		// container, since it might have been reused.
+		if status == specs.StateStopped {
+			pid = 0
+		}
+		s = append(s, containerSummary{
+			ID:         u.State.ID,
+			Pid:        pid,
+			Status:     string(status),
+			Bundle:     u.State.Bundle,
+			Created:    u.Created,
+			Unikernel:  u.UnikernelType(),
+			Hypervisor: u.Hypervisor(),
+		})
+	}
+	return s, nil
+}
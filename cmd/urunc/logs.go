@@ -0,0 +1,253 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/creack/pty"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/urunc-dev/urunc/pkg/unikontainers"
+)
+
+var logsCommand = cli.Command{
+	Name:  "logs",
+	Usage: "output the guest console log of a container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The logs command outputs the guest console of a unikernel, as captured
+in its console log. The console log is enabled with the --console-log global
+option or the com.urunc.runtime.consoleLog annotation and it is available
+until the container gets deleted.`,
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "LOGS").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		return unikontainers.ReadRotatingFile(unikontainer.ConsoleLogPath(), unikontainers.ConsoleLogFiles, os.Stdout)
+	},
+}
+
+// consoleLoggerCommand copies the guest console to its stdout, which is the
+// console of the container, and to the console log, if its path is given.
+// With --socket, it also serves the guest console to urunc console and
+// forwards its stdin and the input of the clients to the guest. With
+// --terminal, fd 3 is the master of the pty of the monitor, otherwise fd 3
+// is the stdout of the monitor and, with --socket, fd 4 is its stdin. It is
+// started by create and it exits when the monitor exits.
+var consoleLoggerCommand = cli.Command{
+	Name:   "console-logger",
+	Hidden: true,
+	Flags: []cli.Flag{
+		cli.Uint64Flag{
+			Name:  "max-size",
+			Value: unikontainers.DefaultConsoleLogSize,
+		},
+		cli.BoolFlag{
+			Name: "terminal",
+		},
+		cli.StringFlag{
+			Name: "socket",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, maxArgs); err != nil {
+			return err
+		}
+		// Keep logging, even if nobody reads our stdout anymore
+		signal.Ignore(syscall.SIGPIPE)
+
+		var input io.Writer
+		var output io.Reader
+		socketPath := context.String("socket")
+		if context.Bool("terminal") {
+			ptm := os.NewFile(3, "console-ptm")
+			input, output = ptm, ptm
+			restore, err := unikontainers.SetRawTerminal(int(os.Stdin.Fd()))
+			if err != nil {
+				logrus.WithError(err).Warn("failed to set the console in raw mode")
+			} else {
+				defer func() {
+					_ = restore()
+				}()
+			}
+			forwardWindowSize(os.Stdin, ptm)
+		} else {
+			output = os.NewFile(3, "console-stdout")
+			if socketPath != "" {
+				input = os.NewFile(4, "console-stdin")
+			}
+		}
+
+		var log io.Writer
+		if logPath := context.Args().First(); logPath != "" {
+			logFile, err := unikontainers.OpenRotatingFile(logPath, context.Uint64("max-size"), unikontainers.ConsoleLogFiles)
+			if err != nil {
+				return err
+			}
+			defer logFile.Close()
+			log = logFile
+		}
+
+		mux := unikontainers.NewConsoleMux(input, os.Stdout, log)
+		if socketPath != "" {
+			err := mux.Listen(socketPath)
+			if err != nil {
+				return err
+			}
+		}
+		go func() {
+			err := mux.Input(os.Stdin)
+			if err != nil {
+				logrus.WithError(err).Warn("failed to forward the console input")
+			}
+		}()
+		return mux.Run(output)
+	},
+}
+
+// forwardWindowSize applies the window size of the console to the pty of
+// the monitor, now and whenever it changes.
+func forwardWindowSize(console *os.File, ptm *os.File) {
+	resize := func() {
+		err := pty.InheritSize(console, ptm)
+		if err != nil {
+			logrus.WithError(err).Debug("failed to resize the guest console")
+		}
+	}
+	resize()
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			resize()
+		}
+	}()
+}
+
+// consoleLoggerConfig describes what the console logger of a unikontainer
+// does with the guest console
+type consoleLoggerConfig struct {
+	terminal bool
+	log      bool
+	logSize  uint64
+	attach   bool
+}
+
+// startConsoleLogger starts the console logger of the unikontainer, with
+// stdin and stdout as the console of the container and files as the guest
+// console (see consoleLoggerCommand). With a terminal, stdin becomes the
+// controlling terminal of the logger. A nil stdin means /dev/null.
+func startConsoleLogger(context *cli.Context, unikontainer *unikontainers.Unikontainer, config consoleLoggerConfig, stdin *os.File, stdout *os.File, files []*os.File) error {
+	args := []string{os.Args[0]}
+	if logPath := context.GlobalString("log"); logPath != "" {
+		args = append(args, "--log", logPath)
+	}
+	args = append(args, "--log-format", context.GlobalString("log-format"), "console-logger")
+	if config.log {
+		args = append(args, "--max-size", strconv.FormatUint(config.logSize, 10))
+	}
+	if config.terminal {
+		args = append(args, "--terminal")
+	}
+	if config.attach {
+		args = append(args, "--socket", unikontainer.ConsoleSocketPath())
+	}
+	if config.log {
+		args = append(args, unikontainer.ConsoleLogPath())
+	}
+
+	logger := &exec.Cmd{
+		Path:       "/proc/self/exe",
+		Args:       args,
+		Stdout:     stdout,
+		ExtraFiles: files,
+		// The logger must outlive urunc create and it should not get
+		// the signals of its session
+		SysProcAttr: &syscall.SysProcAttr{Setsid: true, Setctty: config.terminal},
+	}
+	if stdin != nil {
+		logger.Stdin = stdin
+	}
+	err := logger.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start the console logger: %w", err)
+	}
+	return logger.Process.Release()
+}
+
+// pipeConsoleLogger starts the console logger of a unikontainer without a
+// terminal, and connects it to the stdio of reexec with pipes. The stdin of
+// the monitor goes through the logger only for the console socket. It
+// returns the pipe ends of the monitor, which should be closed after reexec
+// starts.
+func pipeConsoleLogger(context *cli.Context, unikontainer *unikontainers.Unikontainer, config consoleLoggerConfig, reexec *exec.Cmd) (*pipeEnds, error) {
+	ends := &pipeEnds{}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipe for the console: %w", err)
+	}
+	defer stdoutR.Close()
+	ends.files = append(ends.files, stdoutW)
+	files := []*os.File{stdoutR}
+
+	var stdin *os.File
+	if config.attach {
+		stdinR, stdinW, err := os.Pipe()
+		if err != nil {
+			ends.Close()
+			return nil, fmt.Errorf("failed to create pipe for the console: %w", err)
+		}
+		defer stdinW.Close()
+		ends.files = append(ends.files, stdinR)
+		files = append(files, stdinW)
+		stdin = os.Stdin
+		reexec.Stdin = stdinR
+	}
+
+	err = startConsoleLogger(context, unikontainer, config, stdin, os.Stdout, files)
+	if err != nil {
+		ends.Close()
+		return nil, err
+	}
+	reexec.Stdout = stdoutW
+	return ends, nil
+}
+
+// pipeEnds are the pipe ends which the monitor inherits
+type pipeEnds struct {
+	files []*os.File
+}
+
+// Close closes all the pipe ends
+func (p *pipeEnds) Close() {
+	for _, f := range p.files {
+		f.Close()
+	}
+}
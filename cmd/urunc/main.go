@@ -27,6 +27,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	lSyslog "github.com/sirupsen/logrus/hooks/syslog"
+	"github.com/urunc-dev/urunc/internal/config"
 	"github.com/urunc-dev/urunc/internal/constants"
 	m "github.com/urunc-dev/urunc/internal/metrics"
 
@@ -58,8 +59,8 @@ value for "bundle" is the current directory.`
 
 var version string
 
-// FIXME: We need to find a way to set the output file
-var metrics = m.NewZerologMetrics(constants.TimestampTargetFile)
+// metrics gets set up in app.Before, once the --metrics-target is known
+var metrics = m.NewMockMetrics("")
 
 func main() {
 	root := "/run/urunc"
@@ -96,21 +97,60 @@ func main() {
 			Value: "auto",
 			Usage: "ignore cgroup permission errors ('true', 'false', or 'auto')",
 		},
+		cli.BoolFlag{
+			Name:  "console-log",
+			Usage: "capture the guest console of every container in a log file under its state directory",
+		},
+		cli.BoolFlag{
+			Name:  "console-attach",
+			Usage: "serve the guest console of every container on a socket under its state directory, for urunc console",
+		},
+		cli.StringFlag{
+			Name:  "config",
+			Value: config.DefaultPath,
+			Usage: "the configuration file of urunc, whose log and metrics settings apply unless the respective options are set",
+		},
+		cli.StringFlag{
+			Name:  "metrics-target",
+			Value: constants.TimestampTargetFile,
+			Usage: "where to log the timestamps, when URUNC_TIMESTAMPS=1 ('syslog', 'unixgram:<socket path>' or a file path)",
+		},
 	}
 	app.Commands = []cli.Command{
+		balloonCommand,
+		consoleCommand,
+		consoleLoggerCommand,
 		createCommand,
 		deleteCommand,
+		eventsCommand,
 		killCommand,
+		listCommand,
+		logsCommand,
+		metricsCommand,
+		pauseCommand,
+		resumeCommand,
 		runCommand,
 		// specCommand,
 		startCommand,
-		// stateCommand,
+		stateCommand,
+		updateCommand,
 	}
 	app.Before = func(context *cli.Context) error {
 		if err := reviseRootDir(context); err != nil {
 			return err
 		}
-		return configLogrus(context)
+		if err := loadConfig(context); err != nil {
+			return err
+		}
+		if err := configLogrus(context); err != nil {
+			return err
+		}
+		target := context.GlobalString("metrics-target")
+		if err := m.ValidateTarget(target); err != nil {
+			return err
+		}
+		metrics = m.NewMetrics(target)
+		return nil
 	}
 
 	// If the command returns an error, cli takes upon itself to print
@@ -158,6 +198,32 @@ func reviseRootDir(context *cli.Context) error {
 	return context.GlobalSet("root", root)
 }
 
+// loadConfig loads and validates the configuration file of urunc. Its log
+// and metrics settings become the values of the respective options, unless
+// they are set in the command line.
+func loadConfig(context *cli.Context) error {
+	c, err := config.Load(context.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+	config.Set(c)
+
+	defaults := map[string]string{
+		"log":            c.Log.Path,
+		"log-format":     c.Log.Format,
+		"metrics-target": c.Metrics.Target,
+	}
+	for name, value := range defaults {
+		if value == "" || context.GlobalIsSet(name) {
+			continue
+		}
+		if err := context.GlobalSet(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func configLogrus(context *cli.Context) error {
 	if context.GlobalBool("debug") {
 		logrus.SetLevel(logrus.DebugLevel)
@@ -0,0 +1,136 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/urunc-dev/urunc/internal/constants"
+	m "github.com/urunc-dev/urunc/internal/metrics"
+)
+
+// How long a scrape can take to send its headers
+const readHeaderTimeout = 10 * time.Second
+
+var metricsCommand = cli.Command{
+	Name:  "metrics",
+	Usage: "expose the metrics of urunc",
+	Subcommands: []cli.Command{
+		metricsReportCommand,
+		metricsServeCommand,
+	},
+}
+
+var metricsServeCommand = cli.Command{
+	Name:  "serve",
+	Usage: "serve the histograms of the durations of the phases of the containers to Prometheus",
+	Description: `The serve command serves the histograms of the durations of the phases of
+the creation of the containers, in the Prometheus text format, on /metrics. The
+histograms get aggregated only if urunc runs with URUNC_PROMETHEUS=1 or
+URUNC_PROMETHEUS_TEXTFILE in its environment.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "listen",
+			Value: "127.0.0.1:9469",
+			Usage: "the address to listen on",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "METRICS SERVE").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 0, exactArgs); err != nil {
+			return err
+		}
+		err := os.MkdirAll(constants.PrometheusStateDir, 0o700)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.NewHistograms(constants.PrometheusStateDir))
+		server := &http.Server{
+			Addr:              context.String("listen"),
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+		}
+		return server.ListenAndServe()
+	},
+}
+
+var metricsReportCommand = cli.Command{
+	Name:  "report",
+	Usage: "report the durations of the phases of the containers from their timestamps",
+	Description: `The report command reads the timestamps, which urunc logs with
+URUNC_TIMESTAMPS=1, and prints the durations of the phases of the creation of
+each container, followed by their percentiles across the containers, for the
+phases and for the steps between consecutive timestamps.
+
+The timestamps get read from the --metrics-target file, unless --input is set.
+For the syslog target, export them from the system log (e.g. with
+"journalctl -t urunc -o cat") and pass them to --input.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "input, i",
+			Value: "",
+			Usage: "the file to read the timestamps from, or '-' for stdin",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: `select one of: ` + formatOptions,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "METRICS REPORT").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 0, exactArgs); err != nil {
+			return err
+		}
+		input := context.String("input")
+		if input == "" {
+			file, ok := m.TargetFile(context.GlobalString("metrics-target"))
+			if !ok {
+				return fmt.Errorf("metrics target %s is not a file, set --input", context.GlobalString("metrics-target"))
+			}
+			input = file
+		}
+		var reader io.Reader = os.Stdin
+		if input != "-" {
+			file, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			reader = file
+		}
+		report, err := m.NewReport(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read the timestamps from %s: %w", input, err)
+		}
+
+		switch context.String("format") {
+		case "table":
+			return report.WriteTable(os.Stdout)
+		case "json":
+			return json.NewEncoder(os.Stdout).Encode(report)
+		default:
+			return fmt.Errorf("invalid format option: %s", context.String("format"))
+		}
+	},
+}
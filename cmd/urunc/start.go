@@ -16,6 +16,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -41,11 +42,12 @@ your host.`,
 
 // We keep it as a separate function, since it is also called from
 // the run command
-func startUnikontainer(context *cli.Context) error {
+func startUnikontainer(context *cli.Context) (err error) {
 	// No need to check if containerID is valid, because it will get
 	// checked later. We just want it for the metrics
 	containerID := context.Args().First()
 	metrics.Capture(containerID, "TS11")
+	started := time.Now()
 
 	// get Unikontainer data from state.json
 	unikontainer, err := getUnikontainer(context)
@@ -54,7 +56,15 @@ func startUnikontainer(context *cli.Context) error {
 	}
 	metrics.Capture(containerID, "TS12")
 
-	err = unikontainer.SendStartExecve()
+	// urunc start is the last command of the creation of a container, so
+	// it exports its trace
+	unikontainer.StartTrace("start", unikontainer.TraceContext(), started)
+	defer func() {
+		unikontainer.EndTrace(err)
+		unikontainer.ExportTrace(true)
+	}()
+
+	err = unikontainer.Start()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,160 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/docker/go-units"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var updateCommand = cli.Command{
+	Name:  "update",
+	Usage: "update container resource constraints",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container to be
+updated.`,
+	Description: `The update command changes the CPU, memory and pids limits of a
+unikernel. The limits apply to the cgroup of the monitor and the memory of
+the guest follows the memory limit through its balloon device. The memory
+limit of a running unikernel without a balloon device and the cpuset, where
+the monitor is pinned, can not change.
+
+The limits can be given either with the flags below or as a JSON file with
+the OCI linux resources:
+
+   {
+     "memory": {
+       "limit": 0,
+       "reservation": 0,
+       "swap": 0
+     },
+     "cpu": {
+       "shares": 0,
+       "quota": 0,
+       "period": 0,
+       "cpus": "",
+       "mems": ""
+     },
+     "pids": {
+       "limit": 0
+     }
+   }`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "resources, r",
+			Value: "",
+			Usage: `path to the file containing the resources to update or '-' to read from the standard input`,
+		},
+		cli.StringFlag{
+			Name:  "memory",
+			Usage: "memory limit (in bytes, or with a k, m or g unit)",
+		},
+		cli.StringFlag{
+			Name:  "cpu-quota",
+			Usage: "CPU CFS hardcap limit (in usecs). Allowed cpu time in a given period",
+		},
+		cli.StringFlag{
+			Name:  "cpu-period",
+			Usage: "CPU CFS period to be used for hardcapping (in usecs)",
+		},
+		cli.StringFlag{
+			Name:  "cpuset-cpus",
+			Usage: "CPU(s) to use (only the current ones, since the monitor is pinned to them)",
+		},
+		cli.IntFlag{
+			Name:  "pids-limit",
+			Usage: "maximum number of pids allowed in the container",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "UPDATE").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		resources, err := updateResources(context)
+		if err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		return unikontainer.Update(resources)
+	},
+}
+
+// updateResources returns the resources to update, either from the
+// resources file or from the flags of the command
+func updateResources(context *cli.Context) (*specs.LinuxResources, error) {
+	resources := &specs.LinuxResources{}
+	if path := context.String("resources"); path != "" {
+		var f io.Reader = os.Stdin
+		if path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			f = file
+		}
+		err := json.NewDecoder(f).Decode(resources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the resources: %w", err)
+		}
+		return resources, nil
+	}
+
+	if value := context.String("memory"); value != "" {
+		limit, err := units.RAMInBytes(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for memory: %w", err)
+		}
+		resources.Memory = &specs.LinuxMemory{Limit: &limit}
+	}
+	cpu := &specs.LinuxCPU{Cpus: context.String("cpuset-cpus")}
+	if value := context.String("cpu-quota"); value != "" {
+		quota, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cpu-quota: %w", err)
+		}
+		cpu.Quota = &quota
+	}
+	if value := context.String("cpu-period"); value != "" {
+		period, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cpu-period: %w", err)
+		}
+		cpu.Period = &period
+	}
+	if cpu.Cpus != "" || cpu.Quota != nil || cpu.Period != nil {
+		resources.CPU = cpu
+	}
+	if context.IsSet("pids-limit") {
+		resources.Pids = &specs.LinuxPids{Limit: int64(context.Int("pids-limit"))}
+	}
+	return resources, nil
+}
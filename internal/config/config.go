@@ -0,0 +1,338 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config holds the system-wide configuration of urunc, which gets
+// loaded from a TOML file at startup. Anything missing from the file keeps
+// its default value.
+package config
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+	"github.com/docker/go-units"
+	"github.com/urunc-dev/urunc/internal/constants"
+	m "github.com/urunc-dev/urunc/internal/metrics"
+)
+
+// DefaultPath is the path of the configuration file of urunc
+const DefaultPath = "/etc/urunc/config.toml"
+
+// ErrInvalidConfig is returned when the configuration file is not valid
+var ErrInvalidConfig = errors.New("invalid urunc configuration")
+
+// The hypervisors which can have a section in the configuration file. Keep
+// it in sync with the VMM types of the hypervisors package.
+var hypervisorNames = []string{"cloud-hypervisor", "firecracker", "hedge", "hvt", "kvmtool", "qemu", "spt"}
+
+// Config is the configuration of urunc
+type Config struct {
+	Log     Log     `toml:"log"`
+	Metrics Metrics `toml:"metrics"`
+	Tracing Tracing `toml:"tracing"`
+	Network Network `toml:"network"`
+	Monitor Monitor `toml:"monitor"`
+	// The configuration of each hypervisor, by its name (e.g. qemu)
+	Hypervisors map[string]Hypervisor `toml:"hypervisors"`
+}
+
+// Log holds the defaults of the --log and --log-format options
+type Log struct {
+	Path   string `toml:"path"`
+	Format string `toml:"format"`
+}
+
+// Metrics holds the default of the --metrics-target option
+type Metrics struct {
+	Target string `toml:"target"`
+}
+
+// Tracing holds the OpenTelemetry collector, where the traces get exported,
+// unless the OTEL_EXPORTER_OTLP_* environment variables are set
+type Tracing struct {
+	// Whether the traces get exported
+	Enabled bool `toml:"enabled"`
+	// The base URL of the OTLP/HTTP endpoint of the collector (e.g.
+	// "http://127.0.0.1:4318"). The traces get posted to its /v1/traces path.
+	Endpoint string `toml:"endpoint"`
+}
+
+// Network holds the subnets of the TAP devices of the unikernels
+type Network struct {
+	// The subnet of the static network. The TAP device gets its first
+	// address and the unikernel the second one.
+	StaticSubnet string `toml:"static_subnet"`
+	// The subnet of the dynamic network. The TAP device of each unikernel
+	// in a network namespace gets the second address of the next /24 of
+	// the subnet, starting from the second one.
+	DynamicSubnet string `toml:"dynamic_subnet"`
+}
+
+// Monitor holds the configuration of the rootfs of the monitor
+type Monitor struct {
+	// The size of the tmpfs mounts (e.g. /dev, /tmp) in the rootfs of the
+	// monitor (e.g. "64M")
+	TmpfsSize string `toml:"tmpfs_size"`
+}
+
+// Hypervisor is the configuration of a hypervisor. The annotations of a
+// container override the defaults.
+type Hypervisor struct {
+	// The absolute path of the binary of the hypervisor. By default, it
+	// gets looked up in PATH.
+	Path string `toml:"path"`
+	// The memory of the VM (e.g. "256M"), if the container has no memory
+	// limit
+	DefaultMemory string `toml:"default_memory"`
+	// The number of vCPUs of the VM, if the container has no CPU limit
+	DefaultVCPUs uint `toml:"default_vcpus"`
+	// Extra arguments for the hypervisor, which get appended to the ones
+	// of urunc
+	ExtraArgs []string `toml:"extra_args"`
+	// Whether the hypervisor runs with seccomp filters (true by default)
+	Seccomp *bool `toml:"seccomp"`
+	// The directory of the firmware of QEMU on the host (e.g. the BIOS).
+	// By default, it gets looked up.
+	DataPath string `toml:"data_path"`
+}
+
+// SeccompEnabled returns whether the hypervisor runs with seccomp filters
+func (h Hypervisor) SeccompEnabled() bool {
+	return h.Seccomp == nil || *h.Seccomp
+}
+
+// DefaultMemoryBytes returns the default memory of the VM in bytes, or 0 if
+// it is not set
+func (h Hypervisor) DefaultMemoryBytes() uint64 {
+	if h.DefaultMemory == "" {
+		return 0
+	}
+	size, err := units.RAMInBytes(h.DefaultMemory)
+	if err != nil || size <= 0 {
+		return 0
+	}
+	return uint64(size)
+}
+
+// Default returns the default configuration of urunc
+func Default() *Config {
+	return &Config{
+		Log: Log{Format: "text"},
+		Metrics: Metrics{
+			Target: constants.TimestampTargetFile,
+		},
+		Network: Network{
+			StaticSubnet:  constants.DefaultStaticSubnet,
+			DynamicSubnet: constants.DefaultDynamicSubnet,
+		},
+		Monitor: Monitor{
+			TmpfsSize: constants.DefaultTmpfsSize,
+		},
+		Hypervisors: map[string]Hypervisor{},
+	}
+}
+
+var current atomic.Pointer[Config]
+
+// Get returns the configuration of urunc, as set by Set, or the default one
+func Get() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	return Default()
+}
+
+// Set sets the configuration of urunc for the current process
+func Set(c *Config) {
+	current.Store(c)
+}
+
+// Load reads and validates the configuration file at path. A missing file
+// is not an error and results in the default configuration.
+func Load(path string) (*Config, error) {
+	c := Default()
+	md, err := toml.DecodeFile(path, c)
+	if errors.Is(err, os.ErrNotExist) {
+		return Default(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", path, ErrInvalidConfig, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return nil, fmt.Errorf("%s: %w: unknown keys %s", path, ErrInvalidConfig, strings.Join(keys, ", "))
+	}
+	err = c.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate checks every value of the configuration
+func (c *Config) Validate() error {
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("%w: invalid log format %q", ErrInvalidConfig, c.Log.Format)
+	}
+	if err := m.ValidateTarget(c.Metrics.Target); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if c.Tracing.Enabled && c.Tracing.Endpoint == "" {
+		return fmt.Errorf("%w: tracing is enabled without an endpoint", ErrInvalidConfig)
+	}
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: invalid tracing endpoint %q", ErrInvalidConfig, c.Tracing.Endpoint)
+		}
+	}
+	if _, err := parseSubnet(c.Network.StaticSubnet, 30); err != nil {
+		return fmt.Errorf("%w: invalid static_subnet: %w", ErrInvalidConfig, err)
+	}
+	if _, err := parseSubnet(c.Network.DynamicSubnet, 23); err != nil {
+		return fmt.Errorf("%w: invalid dynamic_subnet: %w", ErrInvalidConfig, err)
+	}
+	if size, err := units.RAMInBytes(c.Monitor.TmpfsSize); err != nil || size < 1024 {
+		return fmt.Errorf("%w: invalid tmpfs_size %q", ErrInvalidConfig, c.Monitor.TmpfsSize)
+	}
+
+	names := make([]string, 0, len(c.Hypervisors))
+	for name := range c.Hypervisors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h := c.Hypervisors[name]
+		if !slices.Contains(hypervisorNames, name) {
+			return fmt.Errorf("%w: unknown hypervisor %q", ErrInvalidConfig, name)
+		}
+		if h.Path != "" && !filepath.IsAbs(h.Path) {
+			return fmt.Errorf("%w: the path of %s is not absolute: %s", ErrInvalidConfig, name, h.Path)
+		}
+		if h.DataPath != "" && !filepath.IsAbs(h.DataPath) {
+			return fmt.Errorf("%w: the data path of %s is not absolute: %s", ErrInvalidConfig, name, h.DataPath)
+		}
+		if h.DefaultMemory != "" && h.DefaultMemoryBytes() == 0 {
+			return fmt.Errorf("%w: invalid default memory of %s: %q", ErrInvalidConfig, name, h.DefaultMemory)
+		}
+		for _, arg := range h.ExtraArgs {
+			if arg == "" {
+				return fmt.Errorf("%w: empty extra argument of %s", ErrInvalidConfig, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Hypervisor returns the configuration of the hypervisor with the given name
+func (c *Config) Hypervisor(name string) Hypervisor {
+	return c.Hypervisors[name]
+}
+
+// TracesURL returns the URL, where the traces get posted, or an empty string
+// if tracing is disabled
+func (t Tracing) TracesURL() string {
+	if !t.Enabled || t.Endpoint == "" {
+		return ""
+	}
+	return strings.TrimSuffix(t.Endpoint, "/") + "/v1/traces"
+}
+
+// TmpfsSizeBytes returns the size of the tmpfs mounts of the monitor
+func (m Monitor) TmpfsSizeBytes() uint64 {
+	size, err := units.RAMInBytes(m.TmpfsSize)
+	if err != nil || size <= 0 {
+		size, _ = units.RAMInBytes(constants.DefaultTmpfsSize)
+	}
+	return uint64(size)
+}
+
+// StaticTapAddr returns the address of the TAP device in the static network,
+// with the prefix length of the subnet (e.g. 172.16.1.1/24)
+func (n Network) StaticTapAddr() string {
+	subnet := n.staticSubnet()
+	return netip.PrefixFrom(subnet.Addr().Next(), subnet.Bits()).String()
+}
+
+// StaticTapIP returns the IP of the TAP device in the static network, which
+// is the gateway of the unikernel
+func (n Network) StaticTapIP() string {
+	return n.staticSubnet().Addr().Next().String()
+}
+
+// StaticUnikernelIP returns the IP of the unikernel in the static network
+func (n Network) StaticUnikernelIP() string {
+	return n.staticSubnet().Addr().Next().Next().String()
+}
+
+// StaticMask returns the netmask of the static network (e.g. 255.255.255.0)
+func (n Network) StaticMask() string {
+	return net.IP(net.CIDRMask(n.staticSubnet().Bits(), 32)).String()
+}
+
+func (n Network) staticSubnet() netip.Prefix {
+	subnet, err := parseSubnet(n.StaticSubnet, 30)
+	if err != nil {
+		subnet, _ = parseSubnet(constants.DefaultStaticSubnet, 30)
+	}
+	return subnet
+}
+
+// DynamicTapAddr returns the address of the TAP device with the given index
+// in the dynamic network, with its prefix length (e.g. 172.16.1.2/24)
+func (n Network) DynamicTapAddr(index int) (netip.Prefix, error) {
+	subnet, err := parseSubnet(n.DynamicSubnet, 23)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	base := subnet.Addr().As4()
+	var addr [4]byte
+	binary.BigEndian.PutUint32(addr[:], binary.BigEndian.Uint32(base[:])+uint32(index+1)<<8+2) //nolint: gosec
+	ip := netip.AddrFrom4(addr)
+	if index < 0 || !subnet.Contains(ip) {
+		return netip.Prefix{}, fmt.Errorf("no address for TAP device %d in %s", index, subnet)
+	}
+	return netip.PrefixFrom(ip, 24), nil
+}
+
+// parseSubnet parses an IPv4 subnet with a prefix length up to maxBits
+func parseSubnet(subnet string, maxBits int) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if !prefix.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("%s is not an IPv4 subnet", subnet)
+	}
+	if prefix.Bits() > maxBits {
+		return netip.Prefix{}, fmt.Errorf("%s is smaller than a /%d", subnet, maxBits)
+	}
+	return prefix.Masked(), nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+[log]
+path = "/var/log/urunc.log"
+format = "json"
+
+[metrics]
+target = "syslog"
+
+[tracing]
+enabled = true
+endpoint = "http://127.0.0.1:4318/"
+
+[network]
+static_subnet = "10.10.0.0/16"
+dynamic_subnet = "10.20.0.0/16"
+
+[monitor]
+tmpfs_size = "128M"
+
+[hypervisors.qemu]
+path = "/opt/qemu/bin/qemu-system-x86_64"
+default_memory = "512M"
+default_vcpus = 2
+extra_args = ["-device", "virtio-rng-pci"]
+data_path = "/opt/qemu/share/qemu"
+
+[hypervisors.firecracker]
+seccomp = false
+`
+
+func writeConfig(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load(filepath.Join(t.TempDir(), "config.toml"))
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), c)
+	assert.True(t, c.Hypervisor("qemu").SeccompEnabled())
+	assert.Zero(t, c.Hypervisor("qemu").DefaultMemoryBytes())
+	assert.Equal(t, uint64(64*1024*1024), c.Monitor.TmpfsSizeBytes())
+
+	c, err = Load(writeConfig(t, testConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, Log{Path: "/var/log/urunc.log", Format: "json"}, c.Log)
+	assert.Equal(t, "syslog", c.Metrics.Target)
+	assert.Equal(t, "http://127.0.0.1:4318/v1/traces", c.Tracing.TracesURL())
+	assert.Equal(t, uint64(128*1024*1024), c.Monitor.TmpfsSizeBytes())
+	qemu := c.Hypervisor("qemu")
+	assert.Equal(t, "/opt/qemu/bin/qemu-system-x86_64", qemu.Path)
+	assert.Equal(t, uint64(512*1024*1024), qemu.DefaultMemoryBytes())
+	assert.Equal(t, uint(2), qemu.DefaultVCPUs)
+	assert.Equal(t, []string{"-device", "virtio-rng-pci"}, qemu.ExtraArgs)
+	assert.True(t, qemu.SeccompEnabled())
+	assert.Equal(t, "/opt/qemu/share/qemu", qemu.DataPath)
+	assert.False(t, c.Hypervisor("firecracker").SeccompEnabled())
+	assert.Equal(t, Hypervisor{}, c.Hypervisor("hvt"))
+
+	// Anything missing keeps its default
+	c, err = Load(writeConfig(t, "[log]\nformat = \"json\"\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, Default().Network, c.Network)
+	assert.Equal(t, Default().Metrics, c.Metrics)
+	assert.Empty(t, c.Tracing.TracesURL())
+
+	// An endpoint alone does not enable tracing
+	c, err = Load(writeConfig(t, "[tracing]\nendpoint = \"http://127.0.0.1:4318\"\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, c.Tracing.TracesURL())
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"syntax", "[log\n"},
+		{"unknown key", "[log]\nlevel = \"debug\"\n"},
+		{"unknown section", "[runtime]\nroot = \"/run/urunc\"\n"},
+		{"type", "[hypervisors.qemu]\ndefault_vcpus = \"two\"\n"},
+		{"log format", "[log]\nformat = \"xml\"\n"},
+		{"metrics target", "[metrics]\ntarget = \"unixgram:\"\n"},
+		{"tracing without endpoint", "[tracing]\nenabled = true\n"},
+		{"tracing endpoint", "[tracing]\nendpoint = \"127.0.0.1:4318\"\n"},
+		{"static subnet", "[network]\nstatic_subnet = \"172.16.1.0/31\"\n"},
+		{"IPv6 subnet", "[network]\ndynamic_subnet = \"fd00::/64\"\n"},
+		{"dynamic subnet", "[network]\ndynamic_subnet = \"172.16.1.0/24\"\n"},
+		{"tmpfs size", "[monitor]\ntmpfs_size = \"lots\"\n"},
+		{"hypervisor", "[hypervisors.vmware]\npath = \"/usr/bin/vmware\"\n"},
+		{"relative path", "[hypervisors.qemu]\npath = \"qemu-system-x86_64\"\n"},
+		{"relative data path", "[hypervisors.qemu]\ndata_path = \"share/qemu\"\n"},
+		{"memory", "[hypervisors.hvt]\ndefault_memory = \"0\"\n"},
+		{"extra args", "[hypervisors.spt]\nextra_args = [\"\"]\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tc.data))
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	n := Default().Network
+	assert.Equal(t, "172.16.1.1/24", n.StaticTapAddr())
+	assert.Equal(t, "172.16.1.1", n.StaticTapIP())
+	assert.Equal(t, "172.16.1.2", n.StaticUnikernelIP())
+	assert.Equal(t, "255.255.255.0", n.StaticMask())
+	addr, err := n.DynamicTapAddr(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.16.1.2/24", addr.String())
+	addr, err = n.DynamicTapAddr(4)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.16.5.2/24", addr.String())
+	_, err = n.DynamicTapAddr(255)
+	assert.Error(t, err)
+
+	n = Network{StaticSubnet: "10.0.0.9/29", DynamicSubnet: "10.1.0.0/23"}
+	assert.Equal(t, "10.0.0.9/29", n.StaticTapAddr())
+	assert.Equal(t, "10.0.0.10", n.StaticUnikernelIP())
+	assert.Equal(t, "255.255.255.248", n.StaticMask())
+	addr, err = n.DynamicTapAddr(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.1.2/24", addr.String())
+	_, err = n.DynamicTapAddr(1)
+	assert.Error(t, err)
+}
+
+func TestGetSet(t *testing.T) {
+	defer Set(Get())
+	c := Default()
+	c.Log.Format = "json"
+	Set(c)
+	assert.Same(t, c, Get())
+}
@@ -15,3 +15,11 @@
 package constants
 
 const TimestampTargetFile = "/tmp/urunc.zlog"
+
+// PrometheusStateDir is where urunc aggregates the durations of the phases
+// of the containers for Prometheus
+const PrometheusStateDir = "/run/urunc-prometheus"
+
+// DefaultTmpfsSize is the size of the tmpfs mounts in the rootfs of the
+// monitor
+const DefaultTmpfsSize = "64M"
@@ -15,9 +15,11 @@
 package constants
 
 const (
-	StaticNetworkTapIP       = "172.16.1.1"
-	StaticNetworkUnikernelIP = "172.16.1.2"
-	// TODO: Experiment with DynamicNetworkTapIP starting from 172.16.X.1
-	DynamicNetworkTapIP  = "172.16.X.2"
-	QueueProxyRedirectIP = "172.16.1.2"
+	// DefaultStaticSubnet is the subnet of the static network, where the
+	// TAP device gets 172.16.1.1 and the unikernel 172.16.1.2
+	DefaultStaticSubnet = "172.16.1.0/24"
+	// DefaultDynamicSubnet is the subnet of the dynamic network, where the
+	// TAP device with index X gets 172.16.(X+1).2/24
+	// TODO: Experiment with the TAP devices starting from 172.16.X.1
+	DefaultDynamicSubnet = "172.16.0.0/16"
 )
@@ -15,9 +15,16 @@
 package metrics
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
 	"os"
+	"strings"
 
 	"github.com/rs/zerolog"
+	"github.com/urunc-dev/urunc/internal/constants"
 )
 
 var enableTimestamps = os.Getenv("URUNC_TIMESTAMPS")
@@ -34,13 +41,61 @@ func (z *zerologMetrics) Capture(containerID string, timestampID string) {
 	z.logger.Log().Str("containerID", containerID).Str("timestampID", timestampID).Msg("")
 }
 
+const (
+	// SyslogTarget sends the timestamps to the local syslog daemon
+	SyslogTarget = "syslog"
+	// UnixgramPrefix prefixes the path of a unix datagram socket, where
+	// every timestamp gets sent in its own datagram
+	UnixgramPrefix = "unixgram:"
+)
+
+// ValidateTarget checks that target is a valid destination for the
+// timestamps, which is syslog, unixgram:<path> or the path of a file
+func ValidateTarget(target string) error {
+	if target == "" {
+		return errors.New("empty metrics target")
+	}
+	if path, ok := strings.CutPrefix(target, UnixgramPrefix); ok && path == "" {
+		return fmt.Errorf("no socket path in metrics target %q", target)
+	}
+	return nil
+}
+
+// TargetFile returns the file of target, if the timestamps get written to
+// one
+func TargetFile(target string) (string, bool) {
+	if target == SyslogTarget || strings.HasPrefix(target, UnixgramPrefix) {
+		return "", false
+	}
+	return target, true
+}
+
+// openTarget opens the destination of the timestamps. The timestamps get
+// appended to a file, unless target is syslog or a unix datagram socket.
+func openTarget(target string) (io.Writer, error) {
+	err := ValidateTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if target == SyslogTarget {
+		return syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "urunc")
+	}
+	if path, ok := strings.CutPrefix(target, UnixgramPrefix); ok {
+		return net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	}
+	return os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+}
+
+// NewZerologMetrics returns a Writer, which logs the timestamps to target
+// (see openTarget) with zerolog, if URUNC_TIMESTAMPS is 1. The destination
+// gets opened right away, so it stays reachable after changing the root.
 func NewZerologMetrics(target string) Writer {
 	if enableTimestamps == "1" {
-		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		writer, err := openTarget(target)
 		if err != nil {
 			return nil
 		}
-		logger := zerolog.New(file).Level(zerolog.InfoLevel).With().Timestamp().Logger()
+		logger := zerolog.New(writer).Level(zerolog.InfoLevel).With().Timestamp().Logger()
 		zerolog.TimeFieldFormat = zerolog.TimeFormatUnixNano
 		return &zerologMetrics{
 			logger: &logger,
@@ -49,6 +104,29 @@ func NewZerologMetrics(target string) Writer {
 	return &mockWriter{}
 }
 
+// NewMetrics returns a Writer for all the enabled metrics: the timestamps in
+// target and the Prometheus histograms
+func NewMetrics(target string) Writer {
+	var writers multiWriter
+	for _, writer := range []Writer{NewZerologMetrics(target), NewPrometheusMetrics(constants.PrometheusStateDir)} {
+		if _, isMock := writer.(*mockWriter); writer != nil && !isMock {
+			writers = append(writers, writer)
+		}
+	}
+	if len(writers) == 0 {
+		return &mockWriter{}
+	}
+	return writers
+}
+
+type multiWriter []Writer
+
+func (m multiWriter) Capture(containerID string, timestampID string) {
+	for _, writer := range m {
+		writer.Capture(containerID, timestampID)
+	}
+}
+
 type mockWriter struct{}
 
 func (m *mockWriter) Capture(_, _ string) {}
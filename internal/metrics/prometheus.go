@@ -0,0 +1,350 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	enablePrometheus   = os.Getenv("URUNC_PROMETHEUS")
+	prometheusTextfile = os.Getenv("URUNC_PROMETHEUS_TEXTFILE")
+)
+
+const (
+	histogramsFile = "histograms.json"
+	timestampsExt  = ".ts"
+	// The last timestamp of a container, right before the execve of the
+	// monitor
+	lastTimestamp = "TS18"
+	// The timestamps of a container, which never reaches the execve of the
+	// monitor (e.g. its creation failed), get dropped after this long
+	staleTimestamps = time.Hour
+)
+
+// A Phase is a part of the creation of a container, between two timestamps
+type Phase struct {
+	Name  string
+	Start string
+	End   string
+}
+
+// Phases are the phases, whose durations get aggregated in histograms
+var Phases = []Phase{
+	{Name: "create", Start: "TS00", End: "TS10"},
+	{Name: "reexec", Start: "TS03", End: "TS09"},
+	{Name: "start", Start: "TS11", End: "TS14"},
+	{Name: "execve", Start: "TS14", End: "TS18"},
+	{Name: "total", Start: "TS00", End: "TS18"},
+}
+
+// The upper bounds of the buckets of the histograms in seconds
+var buckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram holds the observations of each bucket, plus the ones above the
+// last bucket, in Counts. Unlike Prometheus, the counts are not cumulative.
+type histogram struct {
+	Counts []uint64 `json:"counts"`
+	Sum    float64  `json:"sum"`
+}
+
+func (h *histogram) observe(seconds float64) {
+	if len(h.Counts) != len(buckets)+1 {
+		h.Counts = make([]uint64, len(buckets)+1)
+	}
+	h.Counts[sort.SearchFloat64s(buckets, seconds)]++
+	h.Sum += seconds
+}
+
+// prometheusMetrics appends the timestamps of each container to a file in
+// dir. The durations of the phases of a container get aggregated, once it
+// reaches the execve of the monitor, by the next collection of Histograms.
+// With a textfile, the collection also takes place right at the execve.
+type prometheusMetrics struct {
+	dir        string
+	histograms *Histograms
+	files      map[string]*os.File
+	// Descriptors (O_PATH) of dir and the directory of the textfile, or -1.
+	// The reexec process captures the last timestamp after changing its
+	// root, so it can reach them only through /proc/self/fd.
+	dirFd         int
+	textfileDirFd int
+}
+
+func (p *prometheusMetrics) Capture(containerID string, timestampID string) {
+	now := time.Now().UnixNano()
+	file, ok := p.files[containerID]
+	if !ok {
+		// Keep the file open, since the reexec process captures the last
+		// timestamp after changing its root and user
+		var err error
+		file, err = os.OpenFile(filepath.Join(p.dir, containerID+timestampsExt), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return
+		}
+		p.files[containerID] = file
+	}
+	_, _ = fmt.Fprintf(file, "%s %d\n", timestampID, now)
+	// urunc create is the last process of a container, which runs on the
+	// host, so it collects the containers that were created before it
+	if timestampID == "TS10" {
+		_, _ = p.histograms.collect()
+	}
+	if timestampID == lastTimestamp {
+		p.flush()
+	}
+}
+
+// flush collects the histograms and rewrites the textfile, so the container
+// does not wait for the next urunc create to show up in the textfile. It
+// gets skipped, if the directories could not be opened in advance or the
+// current user has no access to them.
+func (p *prometheusMetrics) flush() {
+	if p.histograms.textfile == "" || p.dirFd < 0 || p.textfileDirFd < 0 {
+		return
+	}
+	h := &Histograms{
+		dir:      fdPath(p.dirFd, ""),
+		textfile: fdPath(p.textfileDirFd, filepath.Base(p.histograms.textfile)),
+	}
+	_, _ = h.collect()
+}
+
+// fdPath returns the path of name in the directory with the given
+// descriptor, through /proc/self/fd
+func fdPath(fd int, name string) string {
+	return filepath.Join(fmt.Sprintf("/proc/self/fd/%d", fd), name)
+}
+
+// NewPrometheusMetrics returns a Writer, which aggregates the durations of
+// the phases of the containers in histograms under dir, if URUNC_PROMETHEUS
+// is 1 or URUNC_PROMETHEUS_TEXTFILE is set.
+func NewPrometheusMetrics(dir string) Writer {
+	if enablePrometheus != "1" && prometheusTextfile == "" {
+		return &mockWriter{}
+	}
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return &mockWriter{}
+	}
+	p := &prometheusMetrics{
+		dir:           dir,
+		histograms:    NewHistograms(dir),
+		files:         make(map[string]*os.File),
+		dirFd:         -1,
+		textfileDirFd: -1,
+	}
+	if prometheusTextfile != "" {
+		p.dirFd, _ = unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		p.textfileDirFd, _ = unix.Open(filepath.Dir(prometheusTextfile), unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	}
+	return p
+}
+
+// Histograms are the histograms of the durations of the phases of the
+// containers, which urunc aggregates in dir. If URUNC_PROMETHEUS_TEXTFILE is
+// set, they also get written to it in the Prometheus text format, for the
+// textfile collector of node_exporter.
+type Histograms struct {
+	dir      string
+	textfile string
+}
+
+// NewHistograms returns the histograms which urunc aggregates in dir
+func NewHistograms(dir string) *Histograms {
+	return &Histograms{dir: dir, textfile: prometheusTextfile}
+}
+
+// ServeHTTP collects and serves the histograms in the Prometheus text format
+func (h *Histograms) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	histograms, err := h.collect()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = render(w, histograms)
+}
+
+// collect adds the durations of the phases of the containers, which reached
+// the execve of the monitor since the last collection, to the histograms and
+// returns them. The textfile gets rewritten, if any histogram changed.
+func (h *Histograms) collect() (map[string]*histogram, error) {
+	state, err := os.OpenFile(filepath.Join(h.dir, histogramsFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	// Closing the file releases the lock
+	defer state.Close()
+	err = unix.Flock(int(state.Fd()), unix.LOCK_EX)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", state.Name(), err)
+	}
+	data, err := io.ReadAll(state)
+	if err != nil {
+		return nil, err
+	}
+	histograms := make(map[string]*histogram)
+	if len(data) > 0 && json.Unmarshal(data, &histograms) != nil {
+		// Start over, if the histograms got corrupted
+		histograms = make(map[string]*histogram)
+	}
+
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), timestampsExt) {
+			continue
+		}
+		path := filepath.Join(h.dir, entry.Name())
+		timestamps, err := readTimestamps(path)
+		if err != nil {
+			continue
+		}
+		if _, ok := timestamps[lastTimestamp]; !ok {
+			info, err := entry.Info()
+			if err == nil && time.Since(info.ModTime()) > staleTimestamps {
+				_ = os.Remove(path)
+			}
+			continue
+		}
+		for _, phase := range Phases {
+			start, ok := timestamps[phase.Start]
+			if !ok {
+				continue
+			}
+			end, ok := timestamps[phase.End]
+			if !ok || end < start {
+				continue
+			}
+			if histograms[phase.Name] == nil {
+				histograms[phase.Name] = &histogram{}
+			}
+			histograms[phase.Name].observe(float64(end-start) / float64(time.Second))
+		}
+		_ = os.Remove(path)
+		changed = true
+	}
+	// The textfile gets written at least once, even with empty histograms
+	_, err = os.Stat(h.textfile)
+	if !changed && (h.textfile == "" || err == nil) {
+		return histograms, nil
+	}
+
+	data, err = json.Marshal(histograms)
+	if err != nil {
+		return nil, err
+	}
+	err = state.Truncate(0)
+	if err != nil {
+		return nil, err
+	}
+	_, err = state.WriteAt(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if h.textfile != "" {
+		err = writeTextfile(h.textfile, histograms)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return histograms, nil
+}
+
+// readTimestamps reads the timestamps of a container, in nanoseconds,
+// indexed by their ID. If a timestamp appears more than once, the last one
+// wins.
+func readTimestamps(path string) (map[string]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	timestamps := make(map[string]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		id, value, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+		nanos, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		timestamps[id] = nanos
+	}
+	return timestamps, scanner.Err()
+}
+
+// writeTextfile replaces the textfile with the histograms. The textfile
+// collector ignores the temporary file, since it does not end in .prom.
+func writeTextfile(textfile string, histograms map[string]*histogram) error {
+	tmpFile := textfile + ".tmp"
+	file, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644) //nolint: gosec
+	if err != nil {
+		return err
+	}
+	err = render(file, histograms)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, textfile)
+}
+
+// render writes the histograms in the Prometheus text format
+func render(w io.Writer, histograms map[string]*histogram) error {
+	var b strings.Builder
+	b.WriteString("# HELP urunc_phase_duration_seconds The duration of the phases of the creation of unikernel containers.\n")
+	b.WriteString("# TYPE urunc_phase_duration_seconds histogram\n")
+	for _, phase := range Phases {
+		h, ok := histograms[phase.Name]
+		if !ok || len(h.Counts) != len(buckets)+1 {
+			continue
+		}
+		var count uint64
+		for i, bound := range buckets {
+			count += h.Counts[i]
+			fmt.Fprintf(&b, "urunc_phase_duration_seconds_bucket{phase=%q,le=%q} %d\n",
+				phase.Name, strconv.FormatFloat(bound, 'g', -1, 64), count)
+		}
+		count += h.Counts[len(buckets)]
+		fmt.Fprintf(&b, "urunc_phase_duration_seconds_bucket{phase=%q,le=\"+Inf\"} %d\n", phase.Name, count)
+		fmt.Fprintf(&b, "urunc_phase_duration_seconds_sum{phase=%q} %s\n", phase.Name, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "urunc_phase_duration_seconds_count{phase=%q} %d\n", phase.Name, count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
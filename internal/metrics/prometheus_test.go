@@ -0,0 +1,102 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestHistogramsCollect(t *testing.T) {
+	dir := t.TempDir()
+	textfile := filepath.Join(t.TempDir(), "urunc.prom")
+	h := &Histograms{dir: dir, textfile: textfile}
+
+	// Only the containers that reached the execve of the monitor count
+	p := &prometheusMetrics{dir: dir, histograms: h, files: map[string]*os.File{}, dirFd: -1, textfileDirFd: -1}
+	p.Capture("running", "TS00")
+	p.Capture("running", "TS18")
+	p.Capture("creating", "TS00")
+	histograms, err := h.collect()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), histograms["total"].Counts[0])
+	assert.NoFileExists(t, filepath.Join(dir, "running"+timestampsExt))
+	assert.FileExists(t, filepath.Join(dir, "creating"+timestampsExt))
+
+	// The create phase takes 2ms and the start phase 30ms
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "second"+timestampsExt),
+		[]byte("TS00 1000000\nTS10 3000000\nTS11 10000000\nTS14 40000000\nTS18 41000000\n"), 0o600))
+	_, err = h.collect()
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(textfile)
+	assert.NoError(t, err)
+	text := string(data)
+	assert.Contains(t, text, "# TYPE urunc_phase_duration_seconds histogram\n")
+	assert.Contains(t, text, `urunc_phase_duration_seconds_bucket{phase="create",le="0.001"} 0`+"\n")
+	assert.Contains(t, text, `urunc_phase_duration_seconds_bucket{phase="create",le="0.0025"} 1`+"\n")
+	assert.Contains(t, text, `urunc_phase_duration_seconds_bucket{phase="start",le="0.025"} 0`+"\n")
+	assert.Contains(t, text, `urunc_phase_duration_seconds_bucket{phase="start",le="0.05"} 1`+"\n")
+	assert.Contains(t, text, `urunc_phase_duration_seconds_bucket{phase="total",le="+Inf"} 2`+"\n")
+	assert.Contains(t, text, `urunc_phase_duration_seconds_sum{phase="create"} 0.002`+"\n")
+	assert.Contains(t, text, `urunc_phase_duration_seconds_count{phase="total"} 2`+"\n")
+	assert.NotContains(t, text, `phase="reexec"`)
+
+	// The histograms survive across collections
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, text, recorder.Body.String())
+}
+
+func TestFlushAtLastTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	textfileDir := t.TempDir()
+	textfile := filepath.Join(textfileDir, "urunc.prom")
+	dirFd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	assert.NoError(t, err)
+	defer unix.Close(dirFd)
+	textfileDirFd, err := unix.Open(textfileDir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	assert.NoError(t, err)
+	defer unix.Close(textfileDirFd)
+	p := &prometheusMetrics{
+		dir:           dir,
+		histograms:    &Histograms{dir: dir, textfile: textfile},
+		files:         map[string]*os.File{},
+		dirFd:         dirFd,
+		textfileDirFd: textfileDirFd,
+	}
+
+	p.Capture("test", "TS00")
+	p.Capture("test", "TS10")
+	data, err := os.ReadFile(textfile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `phase="total"`)
+
+	// The reexec process can not reach the directories by their paths,
+	// when it captures the last timestamp
+	moved := dir + ".moved"
+	assert.NoError(t, os.Rename(dir, moved))
+	defer os.Rename(moved, dir) //nolint: errcheck
+	p.Capture("test", lastTimestamp)
+	data, err = os.ReadFile(textfile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `urunc_phase_duration_seconds_count{phase="total"} 1`+"\n")
+	assert.NoFileExists(t, filepath.Join(moved, "test"+timestampsExt))
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ContainerReport is the breakdown of the creation of a container
+type ContainerReport struct {
+	ContainerID string `json:"containerID"`
+	// The durations of the Phases, which the container went through
+	Phases map[string]time.Duration `json:"phases"`
+	// The durations between each timestamp and the next one in time
+	Steps []Step `json:"steps"`
+}
+
+// Step is the duration between two consecutive timestamps of a container
+type Step struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Name returns the name of the step, as in "TS00 -> TS01"
+func (s Step) Name() string {
+	return s.From + " -> " + s.To
+}
+
+// Summary holds the distribution of the durations of a phase or a step
+// across the containers
+type Summary struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+}
+
+// Report is the breakdown of the creation of the containers, as found in
+// the timestamps of urunc
+type Report struct {
+	Containers []ContainerReport `json:"containers"`
+	// The summaries of the Phases, followed by the ones of the steps
+	Summaries []Summary `json:"summaries"`
+}
+
+// timestampEntry is a timestamp, as logged by zerologMetrics
+type timestampEntry struct {
+	ContainerID string `json:"containerID"`
+	TimestampID string `json:"timestampID"`
+	Time        int64  `json:"time"`
+}
+
+// NewReport reads the timestamps that zerologMetrics logged from r and
+// returns their breakdown per container. Each timestamp is a JSON object in
+// its own line, which may have a prefix (e.g. the header of syslog). Any
+// other line gets ignored.
+func NewReport(r io.Reader) (*Report, error) {
+	var order []string
+	containers := make(map[string]map[string]int64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		start := bytes.IndexByte(line, '{')
+		if start < 0 {
+			continue
+		}
+		var entry timestampEntry
+		err := json.Unmarshal(line[start:], &entry)
+		if err != nil || entry.ContainerID == "" || entry.TimestampID == "" || entry.Time == 0 {
+			continue
+		}
+		timestamps, ok := containers[entry.ContainerID]
+		if !ok {
+			timestamps = make(map[string]int64)
+			containers[entry.ContainerID] = timestamps
+			order = append(order, entry.ContainerID)
+		}
+		// If a timestamp appears more than once, the last one wins
+		timestamps[entry.TimestampID] = entry.Time
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	durations := make(map[string][]time.Duration)
+	for _, id := range order {
+		c := newContainerReport(id, containers[id])
+		for name, duration := range c.Phases {
+			durations[name] = append(durations[name], duration)
+		}
+		for _, step := range c.Steps {
+			durations[step.Name()] = append(durations[step.Name()], step.Duration)
+		}
+		report.Containers = append(report.Containers, c)
+	}
+	for _, phase := range Phases {
+		if len(durations[phase.Name]) > 0 {
+			report.Summaries = append(report.Summaries, summarize(phase.Name, durations[phase.Name]))
+			delete(durations, phase.Name)
+		}
+	}
+	steps := make([]string, 0, len(durations))
+	for name := range durations {
+		steps = append(steps, name)
+	}
+	sort.Strings(steps)
+	for _, name := range steps {
+		report.Summaries = append(report.Summaries, summarize(name, durations[name]))
+	}
+	return report, nil
+}
+
+func newContainerReport(id string, timestamps map[string]int64) ContainerReport {
+	c := ContainerReport{ContainerID: id, Phases: make(map[string]time.Duration)}
+	for _, phase := range Phases {
+		start, ok := timestamps[phase.Start]
+		if !ok {
+			continue
+		}
+		end, ok := timestamps[phase.End]
+		if !ok || end < start {
+			continue
+		}
+		c.Phases[phase.Name] = time.Duration(end - start)
+	}
+
+	// The processes of a container capture the timestamps concurrently,
+	// so sort them in time
+	ids := make([]string, 0, len(timestamps))
+	for id := range timestamps {
+		if strings.HasPrefix(id, "TS") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if timestamps[ids[i]] == timestamps[ids[j]] {
+			return ids[i] < ids[j]
+		}
+		return timestamps[ids[i]] < timestamps[ids[j]]
+	})
+	for i := 1; i < len(ids); i++ {
+		c.Steps = append(c.Steps, Step{
+			From:     ids[i-1],
+			To:       ids[i],
+			Duration: time.Duration(timestamps[ids[i]] - timestamps[ids[i-1]]),
+		})
+	}
+	return c
+}
+
+// summarize returns the distribution of durations, with the nearest-rank
+// percentiles
+func summarize(name string, durations []time.Duration) Summary {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	percentile := func(p float64) time.Duration {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		return sorted[max(rank, 1)-1]
+	}
+	return Summary{
+		Name:  name,
+		Count: len(sorted),
+		Min:   sorted[0],
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+		Mean:  sum / time.Duration(len(sorted)),
+	}
+}
+
+// WriteTable writes the report as two tables: the phases of each container
+// and the distribution of the durations of each phase and step
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 12, 1, 3, ' ', 0)
+	fmt.Fprint(tw, "CONTAINER")
+	for _, phase := range Phases {
+		fmt.Fprintf(tw, "\t%s", strings.ToUpper(phase.Name))
+	}
+	fmt.Fprintln(tw)
+	for _, c := range r.Containers {
+		fmt.Fprint(tw, c.ContainerID)
+		for _, phase := range Phases {
+			duration, ok := c.Phases[phase.Name]
+			if !ok {
+				fmt.Fprint(tw, "\t-")
+				continue
+			}
+			fmt.Fprintf(tw, "\t%s", formatDuration(duration))
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprint(tw, "PHASE\tCOUNT\tMIN\tP50\tP90\tP99\tMAX\tMEAN\n")
+	for _, s := range r.Summaries {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Count,
+			formatDuration(s.Min), formatDuration(s.P50), formatDuration(s.P90),
+			formatDuration(s.P99), formatDuration(s.Max), formatDuration(s.Mean))
+	}
+	return tw.Flush()
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReport(t *testing.T) {
+	var log strings.Builder
+	// The total of container i is i ms and its create phase i/10 ms
+	for i := 1; i <= 10; i++ {
+		id := fmt.Sprintf("c%02d", i)
+		fmt.Fprintf(&log, `{"containerID":%q,"timestampID":"TS00","time":1000000}`+"\n", id)
+		fmt.Fprintf(&log, `{"containerID":%q,"timestampID":"TS10","time":%d}`+"\n", id, 1000000+i*100000)
+		fmt.Fprintf(&log, `{"containerID":%q,"timestampID":"TS18","time":%d}`+"\n", id, 1000000+i*1000000)
+	}
+	// Lines from syslog and garbage
+	log.WriteString(`Oct 16 10:00:00 host urunc[42]: {"containerID":"c11","timestampID":"TS00","time":5000000}` + "\n")
+	log.WriteString("not a timestamp\n{\"containerID\":\"c12\"}\n")
+
+	report, err := NewReport(strings.NewReader(log.String()))
+	assert.NoError(t, err)
+	assert.Len(t, report.Containers, 11)
+	assert.Equal(t, "c01", report.Containers[0].ContainerID)
+	assert.Equal(t, map[string]time.Duration{
+		"create": 100 * time.Microsecond,
+		"total":  time.Millisecond,
+	}, report.Containers[0].Phases)
+	assert.Equal(t, []Step{
+		{From: "TS00", To: "TS10", Duration: 100 * time.Microsecond},
+		{From: "TS10", To: "TS18", Duration: 900 * time.Microsecond},
+	}, report.Containers[0].Steps)
+	assert.Empty(t, report.Containers[10].Phases)
+
+	names := []string{}
+	for _, s := range report.Summaries {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{"create", "total", "TS00 -> TS10", "TS10 -> TS18"}, names)
+	assert.Equal(t, Summary{
+		Name:  "total",
+		Count: 10,
+		Min:   time.Millisecond,
+		P50:   5 * time.Millisecond,
+		P90:   9 * time.Millisecond,
+		P99:   10 * time.Millisecond,
+		Max:   10 * time.Millisecond,
+		Mean:  5500 * time.Microsecond,
+	}, report.Summaries[1])
+
+	var table bytes.Buffer
+	assert.NoError(t, report.WriteTable(&table))
+	lines := strings.Split(table.String(), "\n")
+	assert.Equal(t, []string{"CONTAINER", "CREATE", "REEXEC", "START", "EXECVE", "TOTAL"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"c01", "100µs", "-", "-", "-", "1ms"}, strings.Fields(lines[1]))
+	assert.Contains(t, table.String(), "\nPHASE ")
+	assert.Equal(t, []string{"total", "10", "1ms", "5ms", "9ms", "10ms", "10ms", "5.5ms"}, strings.Fields(lines[15]))
+}
+
+func TestOpenTarget(t *testing.T) {
+	assert.Error(t, ValidateTarget(""))
+	assert.Error(t, ValidateTarget(UnixgramPrefix))
+	assert.NoError(t, ValidateTarget(SyslogTarget))
+
+	file := filepath.Join(t.TempDir(), "urunc.zlog")
+	path, ok := TargetFile(file)
+	assert.True(t, ok)
+	assert.Equal(t, file, path)
+	_, ok = TargetFile(SyslogTarget)
+	assert.False(t, ok)
+
+	writer, err := openTarget(file)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("line\n"))
+	assert.NoError(t, err)
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "line\n", string(data))
+
+	// Every write is a datagram
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.NoError(t, err)
+	defer conn.Close()
+	writer, err = openTarget(UnixgramPrefix + socket)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(`{"timestampID":"TS00"}` + "\n"))
+	assert.NoError(t, err)
+	buf := make([]byte, 128)
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"timestampID":"TS00"}`+"\n", string(buf[:n]))
+}
@@ -0,0 +1,452 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records the spans of the urunc commands, which handle a
+// container, and exports them as a single trace to an OpenTelemetry
+// collector over OTLP/HTTP, in its JSON encoding.
+//
+// The urunc commands of a container run as separate processes and the reexec
+// process ends with the execve of the monitor, after changing its root and
+// user. Therefore, each process appends its spans to a file in the state
+// directory of the container, through a file descriptor which it opens early,
+// and the spans get exported later by a process which runs on the host.
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urunc-dev/urunc/internal/config"
+)
+
+const (
+	// TraceparentEnv is the environment variable, which carries the
+	// context of the parent span to a process, in the W3C Trace Context
+	// format
+	TraceparentEnv = "TRACEPARENT"
+
+	spansFile       = "spans"
+	traceparentFile = "traceparent"
+	exportTimeout   = 5 * time.Second
+	pollInterval    = 20 * time.Millisecond
+	scopeName       = "github.com/urunc-dev/urunc"
+	defaultService  = "urunc"
+
+	// The span kind and status codes of OTLP
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// ErrInvalidTraceparent is returned when a traceparent can not be parsed
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// endpoint returns the URL, where the traces get exported, as the OpenTelemetry
+// SDKs resolve it from the environment, or an empty string if tracing is
+// disabled. Without the environment variables, the tracing section of the
+// urunc configuration applies.
+func endpoint() string {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return ""
+	}
+	if traces := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); traces != "" {
+		return traces
+	}
+	if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+		return strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	return config.Get().Tracing.TracesURL()
+}
+
+// Enabled returns whether tracing is enabled, which is the case if
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT is set or
+// the urunc configuration enables it, and OTEL_SDK_DISABLED is not true
+func Enabled() bool {
+	return endpoint() != ""
+}
+
+// SpanContext identifies a span and the trace it belongs to
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid returns whether both IDs of the span context are set
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+// Traceparent returns the span context in the W3C Trace Context format
+func (c SpanContext) Traceparent() string {
+	return "00-" + hex.EncodeToString(c.TraceID[:]) + "-" + hex.EncodeToString(c.SpanID[:]) + "-01"
+}
+
+// ParseTraceparent parses a span context in the W3C Trace Context format
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	var c SpanContext
+	fields := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || fields[0] == "ff" ||
+		len(fields[1]) != 32 || len(fields[2]) != 16 || len(fields[3]) != 2 {
+		return c, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+	// Only version 00 has exactly four fields
+	if fields[0] == "00" && len(fields) != 4 {
+		return c, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+	_, err := hex.Decode(c.TraceID[:], []byte(fields[1]))
+	if err != nil {
+		return c, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+	_, err = hex.Decode(c.SpanID[:], []byte(fields[2]))
+	if err != nil {
+		return c, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+	if !c.IsValid() {
+		return c, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+	return c, nil
+}
+
+// FromEnv returns the span context in TRACEPARENT, or an invalid one, if it
+// is not set or can not be parsed
+func FromEnv() SpanContext {
+	c, err := ParseTraceparent(os.Getenv(TraceparentEnv))
+	if err != nil {
+		return SpanContext{}
+	}
+	return c
+}
+
+// WriteContext saves the span context in dir, so the next commands of the
+// container can join its trace
+func WriteContext(dir string, c SpanContext) error {
+	return os.WriteFile(filepath.Join(dir, traceparentFile), []byte(c.Traceparent()), 0o600)
+}
+
+// ReadContext returns the span context, which got saved in dir
+func ReadContext(dir string) (SpanContext, error) {
+	data, err := os.ReadFile(filepath.Join(dir, traceparentFile))
+	if err != nil {
+		return SpanContext{}, err
+	}
+	return ParseTraceparent(string(data))
+}
+
+// Recorder appends the spans, which end, to the spans file of a directory
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder opens the spans file in dir, which must exist, for appending.
+// It returns a nil Recorder, which records nothing, if tracing is disabled.
+func NewRecorder(dir string) (*Recorder, error) {
+	if !Enabled() {
+		return nil, nil
+	}
+	file, err := os.OpenFile(filepath.Join(dir, spansFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: file}, nil
+}
+
+// Start starts a span with the given parent and start time. If the parent is
+// not valid, the span starts a new trace.
+func (r *Recorder) Start(name string, parent SpanContext, start time.Time) *Span {
+	if r == nil {
+		return nil
+	}
+	s := &Span{recorder: r, name: name, start: start}
+	if parent.IsValid() {
+		s.parent = parent.SpanID
+		s.context.TraceID = parent.TraceID
+	} else {
+		_, _ = rand.Read(s.context.TraceID[:])
+	}
+	_, _ = rand.Read(s.context.SpanID[:])
+	return s
+}
+
+// Close closes the spans file
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+func (r *Recorder) record(span otlpSpan) {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A single write, so the lines of concurrent processes do not mix
+	_, _ = r.file.Write(append(data, '\n'))
+}
+
+// Span is an operation of urunc. All its methods are safe to call on a nil
+// Span, which is what a nil Recorder starts.
+type Span struct {
+	recorder   *Recorder
+	name       string
+	context    SpanContext
+	parent     [8]byte
+	start      time.Time
+	attributes []otlpAttribute
+	ended      bool
+}
+
+// Context returns the span context of the span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute sets a string attribute of the span
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.attributes = append(s.attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+}
+
+// Start starts a child span of the span, which starts now
+func (s *Span) Start(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.recorder.Start(name, s.context, time.Now())
+}
+
+// End ends the span now and records it. If err is not nil, the status of the
+// span is set to error. Only the first call has an effect.
+func (s *Span) End(err error) {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+		Name:              s.name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:        s.attributes,
+	}
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if err != nil {
+		span.Status = &otlpStatus{Code: statusCodeError, Message: err.Error()}
+	}
+	s.recorder.record(span)
+}
+
+// Export exports the spans, which got recorded in dir, if tracing is enabled.
+// If until is not empty, it waits for up to timeout for a span with that name
+// to get recorded, before exporting whatever got recorded. Every span gets
+// exported once, even if more processes export the same directory.
+func Export(dir string, until string, timeout time.Duration) error {
+	target := endpoint()
+	if target == "" {
+		return nil
+	}
+	path := filepath.Join(dir, spansFile)
+	deadline := time.Now().Add(timeout)
+	for until != "" && time.Now().Before(deadline) {
+		spans, err := readSpans(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if hasSpan(spans, until) {
+			break
+		}
+		time.Sleep(pollInterval)
+	}
+
+	// Take the spans away from the other exporters
+	exportPath := path + "." + strconv.Itoa(os.Getpid())
+	err := os.Rename(path, exportPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer os.Remove(exportPath)
+	spans, err := readSpans(exportPath)
+	if err != nil {
+		return err
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return post(target, spans)
+}
+
+// readSpans reads the spans file. Any line, which is not a span, gets ignored.
+func readSpans(path string) ([]otlpSpan, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var spans []otlpSpan
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var span otlpSpan
+		if json.Unmarshal(scanner.Bytes(), &span) != nil || span.SpanID == "" {
+			continue
+		}
+		spans = append(spans, span)
+	}
+	return spans, scanner.Err()
+}
+
+func hasSpan(spans []otlpSpan, name string) bool {
+	for _, span := range spans {
+		if span.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// post sends the spans to the collector in an OTLP/HTTP JSON request
+func post(target string, spans []otlpSpan) error {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = defaultService
+	}
+	request := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: service}}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: scopeName},
+				Spans: spans,
+			}},
+		}},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers() {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: exportTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export the spans to %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to export the spans to %s: %s: %s", target, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// headers returns the headers in OTEL_EXPORTER_OTLP_HEADERS, which holds a
+// comma separated list of key=value pairs with URL encoded values
+func headers() map[string]string {
+	h := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = unescaped
+		}
+		h[strings.TrimSpace(key)] = value
+	}
+	return h
+}
+
+// The messages of OTLP in its JSON encoding, as far as urunc uses them
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
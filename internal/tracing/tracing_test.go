@@ -0,0 +1,226 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urunc-dev/urunc/internal/config"
+)
+
+// collector is an in-process stand-in for an OpenTelemetry collector, which
+// keeps the requests it receives over OTLP/HTTP JSON
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request otlpRequest
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" ||
+		r.Header.Get("Content-Type") != "application/json" ||
+		json.NewDecoder(r.Body).Decode(&request) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, request)
+	c.headers = append(c.headers, r.Header)
+	_, _ = w.Write([]byte("{}"))
+}
+
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var spans []otlpSpan
+	for _, request := range c.requests {
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				spans = append(spans, scopeSpans.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	server := httptest.NewServer(c)
+	t.Cleanup(server.Close)
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL)
+	t.Setenv("OTEL_SDK_DISABLED", "")
+	return c
+}
+
+func TestParseTraceparent(t *testing.T) {
+	c, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(t, err)
+	assert.True(t, c.IsValid())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", c.Traceparent())
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	}
+	for _, traceparent := range invalid {
+		_, err := ParseTraceparent(traceparent)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, traceparent)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:4318")
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	assert.False(t, Enabled())
+
+	dir := t.TempDir()
+	r, err := NewRecorder(dir)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+	// Nothing gets recorded through a nil Recorder
+	span := r.Start("create", SpanContext{}, time.Now())
+	span.SetAttribute("container.id", "test")
+	span.Start("hooks").End(nil)
+	span.End(nil)
+	assert.False(t, span.Context().IsValid())
+	assert.NoFileExists(t, filepath.Join(dir, spansFile))
+	assert.NoError(t, Export(dir, "", time.Second))
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	defer config.Set(config.Get())
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_SDK_DISABLED", "")
+
+	c := config.Default()
+	c.Tracing = config.Tracing{Endpoint: "http://127.0.0.1:4318"}
+	config.Set(c)
+	assert.False(t, Enabled())
+
+	c.Tracing.Enabled = true
+	assert.Equal(t, "http://127.0.0.1:4318/v1/traces", endpoint())
+
+	// The environment variables take precedence
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	assert.Equal(t, "http://collector:4318/v1/traces", endpoint())
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	assert.False(t, Enabled())
+}
+
+func TestExport(t *testing.T) {
+	c := newCollector(t)
+	t.Setenv("OTEL_SERVICE_NAME", "urunc-test")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer%20token")
+	dir := t.TempDir()
+
+	// The create command starts the trace
+	create, err := NewRecorder(dir)
+	assert.NoError(t, err)
+	root := create.Start("create", FromEnv(), time.Now())
+	root.SetAttribute("container.id", "test")
+	assert.NoError(t, WriteContext(dir, root.Context()))
+	root.End(nil)
+	assert.NoError(t, create.Close())
+
+	// The reexec process joins it through the environment and its spans
+	// get recorded later
+	t.Setenv(TraceparentEnv, root.Context().Traceparent())
+	reexec, err := NewRecorder(dir)
+	assert.NoError(t, err)
+	reexecSpan := reexec.Start("reexec", FromEnv(), time.Now())
+	reexecSpan.Start("network setup").End(errors.New("no route"))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		reexecSpan.End(nil)
+		reexecSpan.End(nil)
+		_ = reexec.Close()
+	}()
+
+	// The start command joins it through the saved context and waits for
+	// the reexec span
+	parent, err := ReadContext(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, root.Context(), parent)
+	start, err := NewRecorder(dir)
+	assert.NoError(t, err)
+	start.Start("start", parent, time.Now()).End(nil)
+	assert.NoError(t, start.Close())
+	assert.NoError(t, Export(dir, "reexec", 5*time.Second))
+
+	spans := c.spans()
+	assert.Len(t, spans, 4)
+	byName := make(map[string]otlpSpan)
+	for _, span := range spans {
+		assert.Equal(t, spans[0].TraceID, span.TraceID)
+		assert.Equal(t, spanKindInternal, span.Kind)
+		byName[span.Name] = span
+	}
+	rootID := byName["create"].SpanID
+	assert.Empty(t, byName["create"].ParentSpanID)
+	assert.Equal(t, rootID, byName["reexec"].ParentSpanID)
+	assert.Equal(t, rootID, byName["start"].ParentSpanID)
+	assert.Equal(t, byName["reexec"].SpanID, byName["network setup"].ParentSpanID)
+	assert.Equal(t, &otlpStatus{Code: statusCodeError, Message: "no route"}, byName["network setup"].Status)
+	assert.Nil(t, byName["create"].Status)
+	assert.Equal(t, []otlpAttribute{{Key: "container.id", Value: otlpValue{StringValue: "test"}}}, byName["create"].Attributes)
+
+	resource := c.requests[0].ResourceSpans[0].Resource
+	assert.Equal(t, []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "urunc-test"}}}, resource.Attributes)
+	assert.Equal(t, "Bearer token", c.headers[0].Get("Authorization"))
+
+	// Every span gets exported once
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.NoError(t, Export(dir, "", time.Second))
+	assert.Len(t, c.requests, 1)
+}
+
+func TestExportFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", server.URL+"/custom")
+	t.Setenv("OTEL_SDK_DISABLED", "")
+	dir := t.TempDir()
+
+	r, err := NewRecorder(dir)
+	assert.NoError(t, err)
+	r.Start("create", SpanContext{}, time.Now()).End(nil)
+	assert.NoError(t, r.Close())
+	// Do not wait for long for a span which never gets recorded
+	err = Export(dir, "reexec", 50*time.Millisecond)
+	assert.ErrorContains(t, err, "503")
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/jackpal/gateway"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
 )
 
@@ -292,6 +293,33 @@ func Cleanup(tapDevice string) error {
 	return nil
 }
 
+// TapStats returns the statistics of the TAP devices in the network namespace
+// of the process with the given pid, indexed by the name of the device
+func TapStats(pid int) (map[string]*netlink.LinkStatistics, error) {
+	ns, err := netns.GetFromPid(pid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the network namespace of %d: %w", pid, err)
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	links, err := handle.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]*netlink.LinkStatistics)
+	for _, link := range links {
+		if link.Type() != "tuntap" || link.Attrs().Statistics == nil {
+			continue
+		}
+		stats[link.Attrs().Name] = link.Attrs().Statistics
+	}
+	return stats, nil
+}
+
 func deleteIngressQdisc(link netlink.Link) error {
 	qdiscs, err := netlink.QdiscList(link)
 	if err != nil {
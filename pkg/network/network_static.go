@@ -21,12 +21,10 @@ import (
 	"os/exec"
 	"strings"
 
-	"github.com/urunc-dev/urunc/internal/constants"
+	"github.com/urunc-dev/urunc/internal/config"
 	"github.com/vishvananda/netlink"
 )
 
-var StaticIPAddr = fmt.Sprintf("%s/24", constants.StaticNetworkTapIP)
-
 type StaticNetwork struct {
 }
 
@@ -97,20 +95,21 @@ func (n StaticNetwork) NetworkSetup(uid uint32, gid uint32) (*UnikernelNetworkIn
 		netlog.Errorf("failed to find %s interface", DefaultInterface)
 		return nil, err
 	}
-	newTapDevice, err := networkSetup(newTapName, StaticIPAddr, redirectLink, addTCRules, uid, gid)
+	staticNetwork := config.Get().Network
+	newTapDevice, err := networkSetup(newTapName, staticNetwork.StaticTapAddr(), redirectLink, addTCRules, uid, gid)
 	if err != nil {
 		return nil, err
 	}
-	err = setNATRule(DefaultInterface, StaticIPAddr)
+	err = setNATRule(DefaultInterface, staticNetwork.StaticTapAddr())
 	if err != nil {
 		return nil, err
 	}
 	return &UnikernelNetworkInfo{
 		TapDevice: newTapDevice.Attrs().Name,
 		EthDevice: Interface{
-			IP:             constants.StaticNetworkUnikernelIP,
-			DefaultGateway: constants.StaticNetworkTapIP,
-			Mask:           "255.255.255.0",
+			IP:             staticNetwork.StaticUnikernelIP(),
+			DefaultGateway: staticNetwork.StaticTapIP(),
+			Mask:           staticNetwork.StaticMask(),
 			Interface:      DefaultInterface, // or tap0_urunc?
 			MAC:            redirectLink.Attrs().HardwareAddr.String(),
 		},
@@ -0,0 +1,224 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/cgroups/v3"
+	"github.com/containerd/cgroups/v3/cgroup2"
+	"github.com/docker/go-units"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// The memory the VMM needs on top of the guest memory (64 MiB)
+	defaultMemoryOverhead int64 = 64 * 1024 * 1024
+	defaultSystemdSlice         = "system.slice"
+	systemdScopePrefix          = "urunc"
+	cgroupMountpoint            = "/sys/fs/cgroup"
+)
+
+// Cgroup is the cgroup v2 where urunc placed the monitor process. It is
+// stored in state.json, so Delete can remove it.
+type Cgroup struct {
+	// The path of the cgroup relative to the cgroup mountpoint
+	Path string `json:"path"`
+	// The slice and the unit of the cgroup, if it is managed by systemd
+	Systemd bool   `json:"systemd,omitempty"`
+	Slice   string `json:"slice,omitempty"`
+	Unit    string `json:"unit,omitempty"`
+}
+
+// newCgroup parses the cgroupsPath of the spec. With the systemd driver, it
+// has the form "slice:prefix:name", otherwise it is a path in the cgroup
+// hierarchy. If it is empty, a default path based on the container ID is used.
+func newCgroup(cgroupsPath string, id string, systemd bool) (*Cgroup, error) {
+	if !systemd {
+		path := cgroupsPath
+		if path == "" {
+			path = id
+		}
+		// Relative paths are relative to the root of the hierarchy
+		return &Cgroup{Path: filepath.Clean("/" + path)}, nil
+	}
+
+	slice, prefix, name := defaultSystemdSlice, systemdScopePrefix, id
+	if cgroupsPath != "" {
+		parts := strings.Split(cgroupsPath, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid systemd cgroups path %q, expected slice:prefix:name", cgroupsPath)
+		}
+		if parts[0] != "" {
+			slice = parts[0]
+		}
+		prefix, name = parts[1], parts[2]
+	}
+	unit := name
+	if !strings.HasSuffix(name, ".slice") {
+		if prefix != "" {
+			unit = prefix + "-" + name
+		}
+		unit += ".scope"
+	}
+	return &Cgroup{
+		Path:    systemdPath(slice, unit),
+		Systemd: true,
+		Slice:   slice,
+		Unit:    unit,
+	}, nil
+}
+
+// systemdPath returns the path of a systemd unit in the cgroup hierarchy.
+// A slice named a-b.slice is nested under a.slice.
+func systemdPath(slice string, unit string) string {
+	path := "/"
+	name := strings.TrimSuffix(slice, ".slice")
+	if name != "" && name != "-" {
+		parent := ""
+		for _, part := range strings.Split(name, "-") {
+			parent += part
+			path = filepath.Join(path, parent+".slice")
+			parent += "-"
+		}
+	}
+	return filepath.Join(path, unit)
+}
+
+// memoryOverhead returns the memory that the VMM can use on top of the guest
+// memory. It can be set with the memoryOverhead annotation.
+func (u *Unikontainer) memoryOverhead() int64 {
+	value := u.State.Annotations[annotMemoryOverhead]
+	if value == "" {
+		return defaultMemoryOverhead
+	}
+	overhead, err := units.RAMInBytes(value)
+	if err != nil || overhead < 0 {
+		uniklog.WithField(annotMemoryOverhead, value).Warn("invalid memory overhead, using the default")
+		return defaultMemoryOverhead
+	}
+	return overhead
+}
+
+// cgroupResources converts the given resources to cgroup v2 resources.
+// The memory limit of the container is the guest memory and hence the
+// monitor's cgroup gets the memory overhead on top of it.
+func (u *Unikontainer) cgroupResources(spec *specs.LinuxResources) *cgroup2.Resources {
+	if spec == nil {
+		return &cgroup2.Resources{}
+	}
+	resources := cgroup2.ToResources(spec)
+	if resources.Memory != nil && resources.Memory.Max != nil && *resources.Memory.Max > 0 {
+		limit := *resources.Memory.Max + u.memoryOverhead()
+		resources.Memory.Max = &limit
+	}
+	return resources
+}
+
+// SetupCgroup creates the cgroup of the unikontainer, or joins it if it
+// already exists, applies the resource limits and places the process with
+// the given pid (the reexec process, which becomes the monitor) in it.
+// Only cgroup v2 is supported.
+func (u *Unikontainer) SetupCgroup(pid int, systemd bool) error {
+	if cgroups.Mode() != cgroups.Unified {
+		uniklog.Warn("cgroup v2 is not available, the monitor will not be placed in a cgroup")
+		return nil
+	}
+	cgroupsPath := ""
+	if u.Spec.Linux != nil {
+		cgroupsPath = u.Spec.Linux.CgroupsPath
+	}
+	cg, err := newCgroup(cgroupsPath, u.State.ID, systemd)
+	if err != nil {
+		return err
+	}
+
+	resources := u.cgroupResources(u.resources())
+	var manager *cgroup2.Manager
+	if cg.Systemd {
+		manager, err = cgroup2.NewSystemd(cg.Slice, cg.Unit, pid, resources)
+		if err != nil {
+			return fmt.Errorf("failed to create systemd unit %s: %w", cg.Unit, err)
+		}
+		// systemd does not handle all the resources (e.g. cpuset)
+		err = manager.Update(resources)
+	} else {
+		manager, err = cgroup2.NewManager(cgroupMountpoint, cg.Path, resources)
+		if err != nil {
+			return fmt.Errorf("failed to create cgroup %s: %w", cg.Path, err)
+		}
+		err = manager.AddProc(uint64(pid)) //nolint: gosec
+	}
+	// Record the cgroup even on failure, so Delete will remove it
+	u.Cgroup = cg
+	saveErr := u.saveContainerState()
+	if err != nil {
+		return fmt.Errorf("failed to set up cgroup %s: %w", cg.Path, err)
+	}
+	if saveErr != nil {
+		return fmt.Errorf("failed to save the cgroup %s: %w", cg.Path, saveErr)
+	}
+	uniklog.WithField("cgroup", cg.Path).Debug("Placed the monitor in its cgroup")
+	return nil
+}
+
+// manager returns the manager of an existing cgroup
+func (c *Cgroup) manager() (*cgroup2.Manager, error) {
+	if c.Systemd {
+		return cgroup2.LoadSystemd(c.Slice, c.Unit)
+	}
+	return cgroup2.Load(c.Path, cgroup2.WithMountpoint(cgroupMountpoint))
+}
+
+// updateCgroup applies the given resources to the cgroup of the monitor
+func (u *Unikontainer) updateCgroup(resources *specs.LinuxResources) error {
+	if u.Cgroup == nil {
+		uniklog.Warn("the monitor is not in a cgroup, the limits will not be applied to it")
+		return nil
+	}
+	manager, err := u.Cgroup.manager()
+	if err != nil {
+		return err
+	}
+	err = manager.Update(u.cgroupResources(resources))
+	if err != nil {
+		return fmt.Errorf("failed to update cgroup %s: %w", u.Cgroup.Path, err)
+	}
+	return nil
+}
+
+// removeCgroup removes the cgroup of the unikontainer. It should be called
+// after the monitor has exited.
+func (u *Unikontainer) removeCgroup() error {
+	if u.Cgroup == nil {
+		return nil
+	}
+	manager, err := u.Cgroup.manager()
+	if err != nil {
+		return err
+	}
+	if u.Cgroup.Systemd {
+		return manager.DeleteSystemd()
+	}
+	err = manager.Delete()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cgroup %s: %w", u.Cgroup.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCgroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		cgroupsPath string
+		systemd     bool
+		expected    *Cgroup
+	}{
+		{"cgroupfs default", "", false, &Cgroup{Path: "/test"}},
+		{"cgroupfs absolute", "/kubepods/pod1/test", false, &Cgroup{Path: "/kubepods/pod1/test"}},
+		{"cgroupfs relative", "urunc/../test", false, &Cgroup{Path: "/test"}},
+		{"systemd default", "", true, &Cgroup{
+			Path: "/system.slice/urunc-test.scope", Systemd: true, Slice: "system.slice", Unit: "urunc-test.scope",
+		}},
+		{"systemd nested slice", "kubepods-besteffort.slice:cri-containerd:abc", true, &Cgroup{
+			Path:    "/kubepods.slice/kubepods-besteffort.slice/cri-containerd-abc.scope",
+			Systemd: true,
+			Slice:   "kubepods-besteffort.slice",
+			Unit:    "cri-containerd-abc.scope",
+		}},
+		{"systemd empty slice", ":urunc:test", true, &Cgroup{
+			Path: "/system.slice/urunc-test.scope", Systemd: true, Slice: "system.slice", Unit: "urunc-test.scope",
+		}},
+		{"systemd slice unit", "machine.slice::test.slice", true, &Cgroup{
+			Path: "/machine.slice/test.slice", Systemd: true, Slice: "machine.slice", Unit: "test.slice",
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cg, err := newCgroup(tc.cgroupsPath, "test", tc.systemd)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cg)
+		})
+	}
+
+	_, err := newCgroup("/kubepods/test", "test", true)
+	assert.Error(t, err)
+}
+
+func TestCgroupResources(t *testing.T) {
+	const mib = 1024 * 1024
+	limit := int64(256 * mib)
+	noLimit := int64(-1)
+	tests := []struct {
+		name        string
+		limit       *int64
+		annotations map[string]string
+		expected    *int64
+	}{
+		{"no limit", nil, nil, nil},
+		{"unlimited", &noLimit, nil, &noLimit},
+		{"default overhead", &limit, nil, int64Ptr(limit + defaultMemoryOverhead)},
+		{"overhead annotation", &limit, map[string]string{annotMemoryOverhead: "128M"}, int64Ptr(limit + 128*mib)},
+		{"no overhead", &limit, map[string]string{annotMemoryOverhead: "0"}, &limit},
+		{"invalid annotation", &limit, map[string]string{annotMemoryOverhead: "lots"}, int64Ptr(limit + defaultMemoryOverhead)},
+		{"negative annotation", &limit, map[string]string{annotMemoryOverhead: "-128M"}, int64Ptr(limit + defaultMemoryOverhead)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pids := int64(64)
+			u := &Unikontainer{
+				State: &specs.State{ID: "test", Annotations: tc.annotations},
+				Spec: &specs.Spec{
+					Linux: &specs.Linux{
+						Resources: &specs.LinuxResources{
+							Memory: &specs.LinuxMemory{Limit: tc.limit},
+							Pids:   &specs.LinuxPids{Limit: pids},
+						},
+					},
+				},
+			}
+			resources := u.cgroupResources(u.Spec.Linux.Resources)
+			assert.Equal(t, pids, resources.Pids.Max)
+			if tc.expected == nil {
+				assert.True(t, resources.Memory == nil || resources.Memory.Max == nil)
+				return
+			}
+			assert.Equal(t, *tc.expected, *resources.Memory.Max)
+		})
+	}
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
@@ -47,6 +47,50 @@ const (
 	annotMountRootfs   = "com.urunc.unikernel.mountRootfs"
 )
 
+// Runtime annotations, which control how urunc manages the unikernel and
+// can be set per container. Unlike the above, they are plain strings and
+// they are not part of the UnikernelConfig.
+const (
+	// How long to wait for the guest to shut down (e.g. "30s")
+	annotStopTimeout = "com.urunc.runtime.stopTimeout"
+	// Configure the VM through the API socket of the VMM, if supported
+	// (e.g. Firecracker), instead of a config file
+	annotVMMAPI = "com.urunc.runtime.vmmAPI"
+	// The number of vCPUs of the VM. It overrides the value derived from
+	// the CPU resources of the container
+	annotVCPUs = "com.urunc.runtime.vcpus"
+	// The size of the hugepages backing the guest memory (e.g. "2M"), or
+	// "false" to use regular pages even if the container has hugepage limits
+	annotHugepages = "com.urunc.runtime.hugepages"
+	// The memory which the VMM can use on top of the memory limit of the
+	// container (e.g. "64M"), when urunc applies the limit to its cgroup
+	annotMemoryOverhead = "com.urunc.runtime.memoryOverhead"
+	// Add a balloon device to the VM, so the host can reclaim the unused
+	// memory of the guest, if the VMM supports it
+	annotBalloon = "com.urunc.runtime.balloon"
+	// Make the VMM export its metrics for urunc events, if the VMM needs to
+	// get set up for it (e.g. Firecracker)
+	annotVMMetrics = "com.urunc.runtime.vmMetrics"
+	// Capture the guest console in a log file under the container's state
+	// directory ("true" or "false"), overriding the --console-log flag
+	annotConsoleLog = "com.urunc.runtime.consoleLog"
+	// The maximum size of each console log file (e.g. "4M")
+	annotConsoleLogSize = "com.urunc.runtime.consoleLogSize"
+	// Serve the guest console on a socket under the container's state
+	// directory for urunc console ("true" or "false"), overriding the
+	// --console-attach flag
+	annotConsoleAttach = "com.urunc.runtime.consoleAttach"
+	// The memory of the VM (e.g. "512M"), if the container has no memory
+	// limit. It overrides the default_memory of the hypervisor in the
+	// configuration file of urunc
+	annotMemory = "com.urunc.runtime.memory"
+	// Run the VMM with seccomp filters ("true"), even if the seccomp option
+	// of the hypervisor in the configuration file of urunc disables them.
+	// It can not disable them. An unconfined container always runs without
+	// them.
+	annotSeccomp = "com.urunc.runtime.seccomp"
+)
+
 // A UnikernelConfig struct holds the info provided by bima image on how to execute our unikernel
 type UnikernelConfig struct {
 	UnikernelType    string `json:"com.urunc.unikernel.unikernelType"`
@@ -0,0 +1,477 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	consoleSock = "console.sock"
+	// The default key sequence which detaches urunc console from the guest
+	// console
+	DefaultDetachKeys = "ctrl-p,ctrl-q"
+	// The modes a client of the console socket can request
+	consoleReadWrite = "rw"
+	consoleReadOnly  = "ro"
+	// How long a client of the console socket can block the guest console
+	consoleWriteTimeout = time.Second
+	// How long the console socket waits for the mode of a new client
+	consoleHandshakeTimeout = 5 * time.Second
+)
+
+var ErrConsoleBusy = errors.New("another client is writing to the console")
+
+// ConsoleSocketPath returns the path of the socket, where urunc console
+// attaches to the guest console of the unikontainer.
+func (u *Unikontainer) ConsoleSocketPath() string {
+	return getSockAddr(u.BaseDir, consoleSock)
+}
+
+// ConsoleAttach returns whether the guest console should be served on the
+// console socket. The consoleAttach annotation overrides the global setting.
+func (u *Unikontainer) ConsoleAttach(global bool) bool {
+	value := u.State.Annotations[annotConsoleAttach]
+	if value == "" {
+		return global
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		uniklog.WithField(annotConsoleAttach, value).Warn("invalid console attach annotation, ignoring it")
+		return global
+	}
+	return enabled
+}
+
+// ConsoleMux multiplexes the guest console. It copies the output of the
+// guest to the primary console (the stdio urunc create got), to the console
+// log and to every client of the console socket. Any number of clients can
+// read the console, but only one at a time can write to it.
+type ConsoleMux struct {
+	input    io.Writer
+	primary  io.Writer
+	log      io.Writer
+	listener net.Listener
+	path     string
+
+	mu      sync.Mutex
+	clients map[net.Conn]struct{}
+	writer  net.Conn
+	closed  bool
+}
+
+// NewConsoleMux returns a ConsoleMux, which writes the input of the clients
+// to input and the output of the guest to primary and log. Any of them can
+// be nil. Without input, the clients can only read the console.
+func NewConsoleMux(input io.Writer, primary io.Writer, log io.Writer) *ConsoleMux {
+	return &ConsoleMux{
+		input:   input,
+		primary: primary,
+		log:     log,
+		clients: make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen serves the console on a unix socket at path
+func (m *ConsoleMux) Listen(path string) error {
+	err := ensureValidSockAddr(path)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	err = os.Chmod(path, 0o600)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	m.listener = listener
+	m.path = path
+	go m.accept()
+	return nil
+}
+
+func (m *ConsoleMux) accept() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				uniklog.WithError(err).Error("failed to accept console client")
+			}
+			return
+		}
+		go m.serve(conn)
+	}
+}
+
+// serve reads the mode of a new client and, for the writer, copies its
+// input to the guest console until it disconnects.
+func (m *ConsoleMux) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(consoleHandshakeTimeout))
+	mode, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	writer, err := m.register(conn, strings.TrimSpace(mode))
+	if err != nil {
+		_, _ = fmt.Fprintf(conn, "error: %v\n", err)
+		return
+	}
+	defer m.unregister(conn)
+	if !writer {
+		// Wait for the client to disconnect
+		_, _ = io.Copy(io.Discard, reader)
+		return
+	}
+	_, err = io.Copy(m.input, reader)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		uniklog.WithError(err).Warn("failed to forward console input")
+	}
+}
+
+// register adds conn to the clients and acknowledges it. It returns whether
+// the client is the writer of the console.
+func (m *ConsoleMux) register(conn net.Conn, mode string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return false, errors.New("the console is closed")
+	}
+	writer := false
+	switch mode {
+	case consoleReadOnly:
+	case consoleReadWrite:
+		if m.input == nil {
+			return false, errors.New("the console is read-only")
+		}
+		if m.writer != nil {
+			return false, ErrConsoleBusy
+		}
+		writer = true
+	default:
+		return false, fmt.Errorf("unknown console mode %q", mode)
+	}
+	_, err := conn.Write([]byte("ok\n"))
+	if err != nil {
+		return false, err
+	}
+	m.clients[conn] = struct{}{}
+	if writer {
+		m.writer = conn
+	}
+	return writer, nil
+}
+
+func (m *ConsoleMux) unregister(conn net.Conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.clients, conn)
+	if m.writer == conn {
+		m.writer = nil
+	}
+}
+
+// broadcast writes p to every client. A client which does not keep up
+// gets disconnected, so it can not stall the guest.
+func (m *ConsoleMux) broadcast(p []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for conn := range m.clients {
+		_ = conn.SetWriteDeadline(time.Now().Add(consoleWriteTimeout))
+		_, err := conn.Write(p)
+		if err != nil {
+			uniklog.WithError(err).Warn("failed to write to console client, disconnecting it")
+			conn.Close()
+			delete(m.clients, conn)
+			if m.writer == conn {
+				m.writer = nil
+			}
+		}
+	}
+}
+
+// Run copies the output of the guest from output to the primary console,
+// the console log and the clients, until output reaches EOF (see
+// TeeConsole). When it returns, the console socket is closed.
+func (m *ConsoleMux) Run(output io.Reader) error {
+	defer m.Close()
+	primary := m.primary
+	if primary == nil {
+		primary = io.Discard
+	}
+	// The clients come first, since they never fail
+	log := io.Writer(clientWriter{m})
+	if m.log != nil {
+		log = io.MultiWriter(log, m.log)
+	}
+	err := TeeConsole(output, primary, log)
+	// The master of a pty returns EIO, once the other end gets closed
+	if errors.Is(err, unix.EIO) {
+		return nil
+	}
+	return err
+}
+
+// clientWriter writes to every client of a ConsoleMux
+type clientWriter struct {
+	m *ConsoleMux
+}
+
+func (w clientWriter) Write(p []byte) (int, error) {
+	w.m.broadcast(p)
+	return len(p), nil
+}
+
+// Input copies the primary console input from in to the guest, until in
+// reaches EOF or the primary console gets closed.
+func (m *ConsoleMux) Input(in io.Reader) error {
+	if m.input == nil {
+		return nil
+	}
+	_, err := io.Copy(m.input, in)
+	if errors.Is(err, unix.EIO) {
+		return nil
+	}
+	return err
+}
+
+// Close stops serving the console socket and disconnects all clients
+func (m *ConsoleMux) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	if m.listener != nil {
+		m.listener.Close()
+		err := os.Remove(m.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			uniklog.WithError(err).Warn("failed to remove the console socket")
+		}
+	}
+	for conn := range m.clients {
+		conn.Close()
+		delete(m.clients, conn)
+	}
+	m.writer = nil
+}
+
+// AttachConsole attaches to the console socket at path. It copies the guest
+// console to out and, unless readOnly, in to the guest console. It returns
+// when the guest console gets closed, or nil as soon as in contains the
+// detachKeys sequence, which does not reach the guest.
+func AttachConsole(path string, in io.Reader, out io.Writer, readOnly bool, detachKeys []byte) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the console: %w", err)
+	}
+	defer conn.Close()
+
+	mode := consoleReadWrite
+	if readOnly {
+		mode = consoleReadOnly
+	}
+	_, err = conn.Write([]byte(mode + "\n"))
+	if err != nil {
+		return fmt.Errorf("failed to connect to the console: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to connect to the console: %w", err)
+	}
+	reply = strings.TrimSpace(reply)
+	if reply != "ok" {
+		return fmt.Errorf("failed to connect to the console: %s", strings.TrimPrefix(reply, "error: "))
+	}
+
+	outputDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(out, reader)
+		outputDone <- err
+	}()
+	detached := make(chan struct{})
+	go func() {
+		var dst io.Writer = conn
+		if readOnly {
+			// Only watch for the detach keys
+			dst = io.Discard
+		}
+		ok, err := copyConsoleInput(dst, in, detachKeys)
+		if err != nil {
+			uniklog.WithError(err).Warn("failed to forward console input")
+		}
+		if ok {
+			close(detached)
+		}
+	}()
+
+	select {
+	case <-detached:
+		return nil
+	case err := <-outputDone:
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		return err
+	}
+}
+
+// copyConsoleInput copies src to dst until src reaches EOF or the detach
+// keys sequence shows up. It returns whether it detached. The bytes of a
+// partially matched sequence are held back, until it is clear they are not
+// part of the sequence.
+func copyConsoleInput(dst io.Writer, src io.Reader, detachKeys []byte) (bool, error) {
+	buf := make([]byte, 1024)
+	prefix := prefixFunction(detachKeys)
+	matched := 0
+	for {
+		n, err := src.Read(buf)
+		out := make([]byte, 0, n+matched)
+		for _, b := range buf[:n] {
+			if len(detachKeys) == 0 {
+				out = append(out, b)
+				continue
+			}
+			// On a mismatch, keep holding back the longest suffix of the
+			// held back bytes, which is still a prefix of the sequence,
+			// and release the rest (KMP)
+			k := matched
+			for k > 0 && b != detachKeys[k] {
+				k = prefix[k-1]
+			}
+			out = append(out, detachKeys[:matched-k]...)
+			matched = k
+			if b == detachKeys[matched] {
+				matched++
+				if matched == len(detachKeys) {
+					_, err = dst.Write(out)
+					return true, err
+				}
+				continue
+			}
+			out = append(out, b)
+		}
+		if len(out) > 0 {
+			_, werr := dst.Write(out)
+			if werr != nil {
+				return false, werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// prefixFunction returns the prefix function of the sequence, i.e. for each
+// i, the length of the longest proper prefix of sequence[:i+1], which is
+// also a suffix of it
+func prefixFunction(sequence []byte) []int {
+	prefix := make([]int, len(sequence))
+	for i := 1; i < len(sequence); i++ {
+		k := prefix[i-1]
+		for k > 0 && sequence[i] != sequence[k] {
+			k = prefix[k-1]
+		}
+		if sequence[i] == sequence[k] {
+			k++
+		}
+		prefix[i] = k
+	}
+	return prefix
+}
+
+// ParseDetachKeys parses a comma separated key sequence, like the one of
+// docker attach. Every key is either a single character or "ctrl-<value>",
+// where value is a letter or one of @, [, \, ], ^ and _. An empty sequence
+// disables detaching.
+func ParseDetachKeys(keys string) ([]byte, error) {
+	if keys == "" {
+		return nil, nil
+	}
+	var sequence []byte
+	for _, key := range strings.Split(keys, ",") {
+		if len(key) == 1 {
+			sequence = append(sequence, key[0])
+			continue
+		}
+		lower := strings.ToLower(key)
+		if len(key) != 6 || !strings.HasPrefix(lower, "ctrl-") {
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+		c := lower[5]
+		switch {
+		case c >= 'a' && c <= 'z':
+			sequence = append(sequence, c-'a'+1)
+		case c == '@':
+			sequence = append(sequence, 0)
+		case c >= '[' && c <= '_':
+			sequence = append(sequence, c-'['+27)
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return sequence, nil
+}
+
+// SetRawTerminal puts the terminal at fd in raw mode, like cfmakeraw(3),
+// and returns a function which restores its previous mode.
+func SetRawTerminal(fd int) (func() error, error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	previous := *termios
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return unix.IoctlSetTermios(fd, unix.TCSETS, &previous)
+	}, nil
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// dialConsole connects to the console socket at path and returns the
+// connection, its reader and the reply of the multiplexer
+func dialConsole(t *testing.T, path string, mode string) (net.Conn, *bufio.Reader, string) {
+	conn, err := net.Dial("unix", path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = conn.Write([]byte(mode + "\n"))
+	assert.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	reply, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	return conn, reader, reply
+}
+
+func TestConsoleMux(t *testing.T) {
+	path := filepath.Join(t.TempDir(), consoleSock)
+	inputR, inputW := io.Pipe()
+	outputR, outputW := io.Pipe()
+	var primary, log bytes.Buffer
+	mux := NewConsoleMux(inputW, &primary, &log)
+	if !assert.NoError(t, mux.Listen(path)) {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- mux.Run(outputR)
+	}()
+
+	writer, writerReader, reply := dialConsole(t, path, consoleReadWrite)
+	assert.Equal(t, "ok\n", reply)
+	_, _, reply = dialConsole(t, path, consoleReadWrite)
+	assert.Equal(t, "error: "+ErrConsoleBusy.Error()+"\n", reply)
+	_, _, reply = dialConsole(t, path, "rx")
+	assert.True(t, strings.HasPrefix(reply, "error: "))
+	reader, readerReader, reply := dialConsole(t, path, consoleReadOnly)
+	assert.Equal(t, "ok\n", reply)
+
+	// Every client gets the output of the guest
+	_, err := outputW.Write([]byte("hello\n"))
+	assert.NoError(t, err)
+	for _, r := range []*bufio.Reader{writerReader, readerReader} {
+		line, err := r.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "hello\n", line)
+	}
+
+	// Only the writer reaches the guest
+	_, err = reader.Write([]byte("ignored\n"))
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("input\n"))
+	assert.NoError(t, err)
+	line, err := bufio.NewReader(inputR).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "input\n", line)
+
+	// Once the writer leaves, another client can write
+	writer.Close()
+	assert.Eventually(t, func() bool {
+		conn, _, reply := dialConsole(t, path, consoleReadWrite)
+		conn.Close()
+		return reply == "ok\n"
+	}, time.Second, 10*time.Millisecond)
+
+	// The guest exits
+	outputW.Close()
+	assert.NoError(t, <-done)
+	_, err = readerReader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, "hello\n", primary.String())
+	assert.Equal(t, "hello\n", log.String())
+}
+
+func TestConsoleMuxReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), consoleSock)
+	mux := NewConsoleMux(nil, nil, nil)
+	if !assert.NoError(t, mux.Listen(path)) {
+		return
+	}
+	defer mux.Close()
+	_, _, reply := dialConsole(t, path, consoleReadWrite)
+	assert.Equal(t, "error: the console is read-only\n", reply)
+	err := AttachConsole(path, strings.NewReader(""), io.Discard, false, nil)
+	assert.EqualError(t, err, "failed to connect to the console: the console is read-only")
+}
+
+func TestConsoleMuxPrimaryFailure(t *testing.T) {
+	// The console gets logged even if nobody reads the primary console
+	var log bytes.Buffer
+	mux := NewConsoleMux(nil, failingWriter{}, &log)
+	assert.NoError(t, mux.Run(strings.NewReader("console output\n")))
+	assert.Equal(t, "console output\n", log.String())
+}
+
+func TestAttachConsoleDetach(t *testing.T) {
+	path := filepath.Join(t.TempDir(), consoleSock)
+	inputR, inputW := io.Pipe()
+	mux := NewConsoleMux(inputW, nil, nil)
+	if !assert.NoError(t, mux.Listen(path)) {
+		return
+	}
+	defer mux.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(inputR).ReadString('\n')
+		received <- line
+	}()
+	// AttachConsole returns on the detach keys, while in stays open
+	inR, inW := io.Pipe()
+	go func() {
+		_, _ = inW.Write([]byte("ls\n\x10\x11"))
+	}()
+	err := AttachConsole(path, inR, io.Discard, false, []byte{0x10, 0x11})
+	assert.NoError(t, err)
+	assert.Equal(t, "ls\n", <-received)
+}
+
+func TestCopyConsoleInput(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+	tests := []struct {
+		name     string
+		input    string
+		keys     []byte
+		output   string
+		detached bool
+	}{
+		{"no keys", "abc\x10\x11def", nil, "abc\x10\x11def", false},
+		{"no detach", "abc", keys, "abc", false},
+		{"detach", "abc\x10\x11def", keys, "abc", true},
+		{"partial match", "a\x10b", keys, "a\x10b", false},
+		{"partial match at EOF", "a\x10", keys, "a", false},
+		{"restarted match", "a\x10\x10\x11b", keys, "a\x10", true},
+		{"overlapping match", "a\x10\x10\x10\x11b", []byte{0x10, 0x10, 0x11}, "a\x10", true},
+		{"overlapping partial match", "a\x10\x10\x10b", []byte{0x10, 0x10, 0x11}, "a\x10\x10\x10b", false},
+		{"repeated prefix", "abaabac", []byte("abac"), "aba", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			detached, err := copyConsoleInput(&out, strings.NewReader(tc.input), tc.keys)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.detached, detached)
+			assert.Equal(t, tc.output, out.String())
+		})
+	}
+}
+
+func TestPrefixFunction(t *testing.T) {
+	assert.Equal(t, []int{}, prefixFunction(nil))
+	assert.Equal(t, []int{0, 1, 0}, prefixFunction([]byte{0x10, 0x10, 0x11}))
+	assert.Equal(t, []int{0, 0, 1, 2, 3, 0}, prefixFunction([]byte("ababac")))
+}
+
+func TestParseDetachKeys(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected []byte
+	}{
+		{"", nil},
+		{DefaultDetachKeys, []byte{0x10, 0x11}},
+		{"ctrl-A,x", []byte{0x01, 'x'}},
+		{"ctrl-@,ctrl-[,ctrl-\\,ctrl-],ctrl-^,ctrl-_", []byte{0, 27, 28, 29, 30, 31}},
+	}
+	for _, tc := range tests {
+		keys, err := ParseDetachKeys(tc.keys)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, keys)
+	}
+
+	for _, keys := range []string{"ctrl-1", "ctrl", "alt-x", "ab", "ctrl-p,"} {
+		_, err := ParseDetachKeys(keys)
+		assert.Error(t, err, keys)
+	}
+}
+
+func TestConsoleAttach(t *testing.T) {
+	u := &Unikontainer{State: &specs.State{ID: "test"}}
+	assert.False(t, u.ConsoleAttach(false))
+	assert.True(t, u.ConsoleAttach(true))
+	u.State.Annotations = map[string]string{annotConsoleAttach: "true"}
+	assert.True(t, u.ConsoleAttach(false))
+	u.State.Annotations = map[string]string{annotConsoleAttach: "no way"}
+	assert.True(t, u.ConsoleAttach(true))
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/go-units"
+)
+
+const (
+	consoleLogFilename = "console.log"
+	// The default maximum size of each console log file (1 MiB)
+	DefaultConsoleLogSize uint64 = 1024 * 1024
+	// The number of console log files, including the current one
+	ConsoleLogFiles = 3
+)
+
+// ConsoleLogPath returns the path of the file where the guest console of the
+// unikontainer gets captured.
+func (u *Unikontainer) ConsoleLogPath() string {
+	return filepath.Join(u.BaseDir, consoleLogFilename)
+}
+
+// ConsoleLog returns whether the guest console should be captured in the
+// console log and the maximum size of each log file. The consoleLog
+// annotation overrides the global setting.
+func (u *Unikontainer) ConsoleLog(global bool) (bool, uint64) {
+	enabled := global
+	if value := u.State.Annotations[annotConsoleLog]; value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err == nil {
+			enabled = parsed
+		} else {
+			uniklog.WithField(annotConsoleLog, value).Warn("invalid console log annotation, ignoring it")
+		}
+	}
+
+	size := DefaultConsoleLogSize
+	if value := u.State.Annotations[annotConsoleLogSize]; value != "" {
+		parsed, err := units.RAMInBytes(value)
+		if err == nil && parsed > 0 {
+			size = uint64(parsed)
+		} else {
+			uniklog.WithField(annotConsoleLogSize, value).Warn("invalid console log size, using the default")
+		}
+	}
+	return enabled, size
+}
+
+// RotatingFile is a log file, which gets rotated when it exceeds maxSize.
+// On rotation, path becomes path.1, path.1 becomes path.2 and so on, keeping
+// at most maxFiles files, including the current one.
+type RotatingFile struct {
+	path     string
+	maxSize  uint64
+	maxFiles int
+	file     *os.File
+	size     uint64
+}
+
+// OpenRotatingFile opens the log file at path for appending
+func OpenRotatingFile(path string, maxSize uint64, maxFiles int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = uint64(info.Size()) // nolint:gosec
+	return nil
+}
+
+// rotate closes the current file, shifts the old files and opens a new one
+func (r *RotatingFile) rotate() error {
+	err := r.file.Close()
+	if err != nil {
+		return err
+	}
+	for i := r.maxFiles - 1; i > 0; i-- {
+		older := rotatedName(r.path, i)
+		newer := rotatedName(r.path, i-1)
+		err = os.Rename(newer, older)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if r.maxFiles <= 1 {
+		err = os.Remove(r.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return r.open()
+}
+
+// Write appends p to the log file, rotating it first if p does not fit.
+// A p larger than maxSize is written as a whole in a new file.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	if r.size > 0 && r.size+uint64(len(p)) > r.maxSize {
+		err := r.rotate()
+		if err != nil {
+			return 0, fmt.Errorf("failed to rotate %s: %w", r.path, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += uint64(n) // nolint:gosec
+	return n, err
+}
+
+// Close closes the current log file
+func (r *RotatingFile) Close() error {
+	return r.file.Close()
+}
+
+// ReadRotatingFile writes the contents of the log file at path and of its
+// rotated files to w, from the oldest to the newest.
+func ReadRotatingFile(path string, maxFiles int, w io.Writer) error {
+	found := false
+	for i := maxFiles - 1; i >= 0; i-- {
+		file, err := os.Open(rotatedName(path, i))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		_, err = io.Copy(w, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s does not exist: %w", path, os.ErrNotExist)
+	}
+	return nil
+}
+
+// rotatedName returns the name of the i-th rotated file of path. The 0-th
+// is the current file.
+func rotatedName(path string, i int) string {
+	if i == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(i)
+}
+
+// TeeConsole copies the guest console from in to both out and log, until in
+// reaches EOF. It keeps logging even if out fails (e.g. nobody reads it).
+func TeeConsole(in io.Reader, out io.Writer, log io.Writer) error {
+	buf := make([]byte, 32*1024)
+	outOK := true
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			_, logErr := log.Write(buf[:n])
+			if logErr != nil {
+				uniklog.WithError(logErr).Error("failed to write to the console log")
+			}
+			if outOK {
+				_, outErr := out.Write(buf[:n])
+				if outErr != nil {
+					uniklog.WithError(outErr).Warn("failed to forward the console, only logging it")
+					outOK = false
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
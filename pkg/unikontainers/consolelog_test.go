@@ -0,0 +1,110 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), consoleLogFilename)
+	r, err := OpenRotatingFile(path, 10, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, line := range []string{"line1\n", "line2\n", "line3\n", "line4\n", "line5\n"} {
+		_, err = r.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, r.Close())
+
+	// Every file holds a single line and the oldest one got dropped
+	for i, expected := range []string{"line5\n", "line4\n", "line3\n"} {
+		data, err := os.ReadFile(rotatedName(path, i))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(data))
+	}
+	_, err = os.Stat(rotatedName(path, 3))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	var out strings.Builder
+	assert.NoError(t, ReadRotatingFile(path, 3, &out))
+	assert.Equal(t, "line3\nline4\nline5\n", out.String())
+
+	// Reopening appends to the current file
+	r, err = OpenRotatingFile(path, 10, 3)
+	assert.NoError(t, err)
+	_, err = r.Write([]byte("6\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "line5\n6\n", string(data))
+}
+
+func TestReadRotatingFileMissing(t *testing.T) {
+	var out strings.Builder
+	err := ReadRotatingFile(filepath.Join(t.TempDir(), consoleLogFilename), 3, &out)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(_ []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestTeeConsole(t *testing.T) {
+	var out, log strings.Builder
+	assert.NoError(t, TeeConsole(strings.NewReader("console output\n"), &out, &log))
+	assert.Equal(t, "console output\n", out.String())
+	assert.Equal(t, "console output\n", log.String())
+
+	// The console gets logged even if nobody reads the output
+	log.Reset()
+	assert.NoError(t, TeeConsole(strings.NewReader("console output\n"), failingWriter{}, &log))
+	assert.Equal(t, "console output\n", log.String())
+}
+
+func TestConsoleLog(t *testing.T) {
+	tests := []struct {
+		name        string
+		global      bool
+		annotations map[string]string
+		enabled     bool
+		size        uint64
+	}{
+		{"disabled", false, nil, false, DefaultConsoleLogSize},
+		{"global", true, nil, true, DefaultConsoleLogSize},
+		{"annotation", false, map[string]string{annotConsoleLog: "true", annotConsoleLogSize: "4M"}, true, 4 * 1024 * 1024},
+		{"annotation overrides global", true, map[string]string{annotConsoleLog: "false"}, false, DefaultConsoleLogSize},
+		{"invalid annotations", true, map[string]string{annotConsoleLog: "maybe", annotConsoleLogSize: "0"}, true, DefaultConsoleLogSize},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &Unikontainer{State: &specs.State{ID: "test", Annotations: tc.annotations}}
+			enabled, size := u.ConsoleLog(tc.global)
+			assert.Equal(t, tc.enabled, enabled)
+			assert.Equal(t, tc.size, size)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/urunc-dev/urunc/pkg/unikontainers/hypervisors"
+	"golang.org/x/sys/unix"
+)
+
+// CPUPinning records how urunc pinned the monitor and the vCPUs of the VM
+// to the cpuset of the container. It is stored in state.json for auditing.
+type CPUPinning struct {
+	// The CPUs where the monitor process (and all of its threads) can run
+	Monitor []int `json:"monitor"`
+	// The dedicated CPU of each vCPU thread, if urunc pinned them
+	VCPUs []VCPUPin `json:"vcpus,omitempty"`
+}
+
+// VCPUPin is the pinning of a single vCPU thread
+type VCPUPin struct {
+	VCPU     int `json:"vcpu"`
+	ThreadID int `json:"threadID"`
+	CPU      int `json:"cpu"`
+}
+
+// cpuset returns the CPUs in the cpuset of the container, or nil if the
+// container does not have one.
+func (u *Unikontainer) cpuset() ([]int, error) {
+	if u.Spec.Linux == nil || u.Spec.Linux.Resources == nil || u.Spec.Linux.Resources.CPU == nil {
+		return nil, nil
+	}
+	if u.Spec.Linux.Resources.CPU.Cpus == "" {
+		return nil, nil
+	}
+	return parseCPUList(u.Spec.Linux.Resources.CPU.Cpus)
+}
+
+// pinMonitor restricts the current process to the cpuset of the container.
+// It should be called right before the execve of the monitor, which
+// inherits the affinity.
+func (u *Unikontainer) pinMonitor() error {
+	cpus, err := u.cpuset()
+	if err != nil || cpus == nil {
+		return err
+	}
+	err = setProcessAffinity(cpus)
+	if err != nil {
+		return fmt.Errorf("failed to set the cpu affinity of the monitor: %w", err)
+	}
+	u.CPUPinning = &CPUPinning{Monitor: cpus}
+	uniklog.WithField("cpus", cpus).Debug("Pinned the monitor to the cpuset")
+	return nil
+}
+
+// PinVCPUs pins each vCPU thread of the monitor to a dedicated CPU of the
+// cpuset of the container and records the pinning in the state. It is a
+// no-op for monitors which can not report their vCPU threads. It should be
+// called after SendStartExecve and it waits for the monitor to start.
+func (u *Unikontainer) PinVCPUs() error {
+	cpus, err := u.cpuset()
+	if err != nil || cpus == nil {
+		return err
+	}
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return err
+	}
+	threader, ok := vmm.(hypervisors.VCPUThreader)
+	if !ok {
+		return nil
+	}
+	threads, err := threader.VCPUThreads(u.BaseDir)
+	if err != nil {
+		return fmt.Errorf("failed to get the vcpu threads: %w", err)
+	}
+	if len(threads) > len(cpus) {
+		uniklog.WithField("vcpus", len(threads)).WithField("cpus", cpus).
+			Warn("not enough CPUs in the cpuset to pin every vCPU to a dedicated CPU")
+		return nil
+	}
+
+	pins := make([]VCPUPin, 0, len(threads))
+	for vcpu, tid := range threads {
+		var set unix.CPUSet
+		set.Set(cpus[vcpu])
+		err = unix.SchedSetaffinity(tid, &set)
+		if err != nil {
+			return fmt.Errorf("failed to pin vcpu %d (thread %d) to cpu %d: %w", vcpu, tid, cpus[vcpu], err)
+		}
+		pins = append(pins, VCPUPin{VCPU: vcpu, ThreadID: tid, CPU: cpus[vcpu]})
+	}
+
+	// The reexec process has updated the state in the meantime (e.g. to
+	// record the pinning of the monitor), so reload it before saving.
+	state, err := loadUnikontainerState(filepath.Join(u.BaseDir, stateFilename))
+	if err != nil {
+		return err
+	}
+	u.State = &state.State
+	u.CPUPinning = state.CPUPinning
+	if u.CPUPinning == nil {
+		u.CPUPinning = &CPUPinning{Monitor: cpus}
+	}
+	u.CPUPinning.VCPUs = pins
+	uniklog.WithField("vcpus", pins).Debug("Pinned the vCPU threads")
+	return u.saveContainerState()
+}
+
+// setProcessAffinity sets the CPU affinity of every thread of the current
+// process. Any thread that gets created afterwards inherits it.
+func setProcessAffinity(cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		err = unix.SchedSetaffinity(tid, &set)
+		// The thread might have exited in the meantime
+		if err != nil && !errors.Is(err, unix.ESRCH) {
+			return err
+		}
+	}
+	return nil
+}
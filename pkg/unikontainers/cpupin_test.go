@@ -0,0 +1,95 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestPinMonitor(t *testing.T) {
+	var orig unix.CPUSet
+	assert.NoError(t, unix.SchedGetaffinity(0, &orig))
+	// Pin to the first CPU we are allowed to run on
+	cpu := -1
+	for i := 0; i < len(orig)*64 && cpu < 0; i++ {
+		if orig.IsSet(i) {
+			cpu = i
+		}
+	}
+	defer func() { _ = setProcessAffinityMask(&orig) }()
+
+	u := &Unikontainer{
+		State: &specs.State{ID: "test", Annotations: map[string]string{}},
+		Spec: &specs.Spec{
+			Linux: &specs.Linux{
+				Resources: &specs.LinuxResources{
+					CPU: &specs.LinuxCPU{Cpus: strconv.Itoa(cpu)},
+				},
+			},
+		},
+		BaseDir: t.TempDir(),
+	}
+	assert.NoError(t, u.pinMonitor())
+	assert.Equal(t, &CPUPinning{Monitor: []int{cpu}}, u.CPUPinning)
+
+	// Every thread of the process must be pinned
+	tasks, err := os.ReadDir("/proc/self/task")
+	assert.NoError(t, err)
+	for _, task := range tasks {
+		tid, _ := strconv.Atoi(task.Name())
+		var set unix.CPUSet
+		if unix.SchedGetaffinity(tid, &set) != nil {
+			continue
+		}
+		assert.Equal(t, 1, set.Count())
+		assert.True(t, set.IsSet(cpu))
+	}
+
+	// The pinning is part of the state
+	assert.NoError(t, u.saveContainerState())
+	state, err := loadUnikontainerState(filepath.Join(u.BaseDir, stateFilename))
+	assert.NoError(t, err)
+	assert.Equal(t, u.CPUPinning, state.CPUPinning)
+}
+
+func TestPinMonitorWithoutCpuset(t *testing.T) {
+	u := &Unikontainer{
+		State: &specs.State{ID: "test", Annotations: map[string]string{}},
+		Spec:  &specs.Spec{},
+	}
+	assert.NoError(t, u.pinMonitor())
+	assert.Nil(t, u.CPUPinning)
+	assert.NoError(t, u.PinVCPUs())
+}
+
+// setProcessAffinityMask restores the affinity of every thread of the process
+func setProcessAffinityMask(set *unix.CPUSet) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, _ := strconv.Atoi(task.Name())
+		_ = unix.SchedSetaffinity(tid, set)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
+)
+
+const (
+	CloudHypervisorVmm        VmmType = "cloud-hypervisor"
+	CloudHypervisorBinary     string  = "cloud-hypervisor"
+	CloudHypervisorSocketName string  = "cloud-hypervisor.sock"
+	chAPITimeout                      = 5 * time.Second
+)
+
+type CloudHypervisor struct {
+	binaryPath string
+	binary     string
+}
+
+// Stop shuts down the guest gracefully and kills the monitor, if it does
+// not exit within args.Timeout.
+func (ch *CloudHypervisor) Stop(args StopArgs) error {
+	return gracefulStop(args, ch.shutdown)
+}
+
+// shutdown presses the virtual power button of the VM through the API.
+// If the API is not available, it sends SIGTERM to Cloud Hypervisor.
+func (ch *CloudHypervisor) shutdown(args StopArgs) error {
+	api, ok := ch.api(args.BaseDir)
+	if ok {
+		err := api.request(http.MethodPut, "/api/v1/vm.power-button", nil)
+		if err == nil {
+			return nil
+		}
+		vmmLog.WithError(err).Warn("failed to press the power button, sending SIGTERM to cloud-hypervisor")
+	}
+	return signalMonitor(args.Pid, syscall.SIGTERM)
+}
+
+// Pause pauses the VM through the API. If the API is not available,
+// it falls back to the cgroup freezer.
+func (ch *CloudHypervisor) Pause(args ControlArgs) error {
+	api, ok := ch.api(args.BaseDir)
+	if !ok {
+		return newCgroupFreezer().Freeze(args.Pid)
+	}
+	return api.request(http.MethodPut, "/api/v1/vm.pause", nil)
+}
+
+// Resume resumes the VM through the API. If the API is not available,
+// it falls back to the cgroup freezer.
+func (ch *CloudHypervisor) Resume(args ControlArgs) error {
+	api, ok := ch.api(args.BaseDir)
+	if !ok {
+		return newCgroupFreezer().Thaw(args.Pid)
+	}
+	return api.request(http.MethodPut, "/api/v1/vm.resume", nil)
+}
+
+// api returns a client for the API socket of Cloud Hypervisor and whether
+// the socket exists.
+func (ch *CloudHypervisor) api(baseDir string) (*unixHTTPClient, bool) {
+	socketPath := filepath.Join(baseDir, ControlDirName, CloudHypervisorSocketName)
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, false
+	}
+	return newUnixHTTPClient(socketPath, chAPITimeout), true
+}
+
+type chResize struct {
+	DesiredBalloon uint64 `json:"desired_balloon"`
+}
+
+type chVMInfo struct {
+	MemoryActualSize uint64 `json:"memory_actual_size"`
+}
+
+// ResizeMemory sets the memory of the guest through the balloon device.
+func (ch *CloudHypervisor) ResizeMemory(args ControlArgs, sizeB uint64) error {
+	api, ok := ch.api(args.BaseDir)
+	if !ok {
+		return fmt.Errorf("the API of cloud-hypervisor is not available")
+	}
+	memSize := args.MemSizeB
+	if memSize == 0 {
+		memSize = DefaultMemory * 1024 * 1024
+	}
+	var balloon uint64
+	if sizeB < memSize {
+		balloon = memSize - sizeB
+	}
+	return api.request(http.MethodPut, "/api/v1/vm.resize", chResize{DesiredBalloon: balloon})
+}
+
+// BalloonStats returns the size of the guest memory. Cloud Hypervisor does
+// not expose the statistics that the guest reports.
+func (ch *CloudHypervisor) BalloonStats(args ControlArgs) (*BalloonStats, error) {
+	api, ok := ch.api(args.BaseDir)
+	if !ok {
+		return nil, fmt.Errorf("the API of cloud-hypervisor is not available")
+	}
+	data, err := api.do(http.MethodGet, "/api/v1/vm.info", nil)
+	if err != nil {
+		return nil, err
+	}
+	var info chVMInfo
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the vm info: %w", err)
+	}
+	return &BalloonStats{Actual: info.MemoryActualSize}, nil
+}
+
+// Ok checks if the cloud-hypervisor binary is available in the system's PATH.
+func (ch *CloudHypervisor) Ok() error {
+	if _, err := lookupVMM(CloudHypervisorVmm, CloudHypervisorBinary); err != nil {
+		return ErrVMMNotInstalled
+	}
+	return nil
+}
+
+// UsesKVM returns a bool value depending on if the monitor uses KVM
+func (ch *CloudHypervisor) UsesKVM() bool {
+	return true
+}
+
+// SupportsSharedfs returns a bool value depending on the monitor support for shared-fs
+// Cloud Hypervisor supports only virtio-fs, which requires an external daemon.
+func (ch *CloudHypervisor) SupportsSharedfs() bool {
+	return false
+}
+
+// SupportsPause returns a bool value depending on the monitor support for pause
+func (ch *CloudHypervisor) SupportsPause() bool {
+	return true
+}
+
+// Path returns the path to the cloud-hypervisor binary.
+func (ch *CloudHypervisor) Path() string {
+	return ch.binaryPath
+}
+
+func (ch *CloudHypervisor) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
+	exArgs := ch.buildArgs(args, ukernel)
+	vmmLog.WithField("cloud-hypervisor command", exArgs).Debug("Ready to execve cloud-hypervisor")
+	return syscall.Exec(ch.Path(), exArgs, args.Environment) //nolint: gosec
+}
+
+// buildArgs creates the command line of Cloud Hypervisor
+func (ch *CloudHypervisor) buildArgs(args ExecArgs, ukernel unikernels.Unikernel) []string {
+	chString := string(CloudHypervisorVmm)
+	chMem := DefaultMemory
+	if args.MemSizeB != 0 {
+		chMem = bytesToMiB(args.MemSizeB)
+		// Check if memory is too small
+		if chMem == 0 {
+			chMem = DefaultMemory
+		}
+	}
+
+	exArgs := []string{ch.Path()}
+	exArgs = append(exArgs, "--kernel", args.UnikernelPath)
+	exArgs = append(exArgs, "--cmdline", args.Command)
+	if args.InitrdPath != "" {
+		exArgs = append(exArgs, "--initramfs", args.InitrdPath)
+	}
+	memory := "size=" + strconv.FormatUint(chMem, 10) + "M"
+	if args.HugePageSize != 0 {
+		memory += ",hugepages=on,hugepage_size=" + hugePageSizeString(args.HugePageSize)
+	}
+	exArgs = append(exArgs, "--memory", memory)
+	exArgs = append(exArgs, "--cpus", "boot="+strconv.FormatUint(uint64(vcpuCount(args)), 10))
+	if args.Balloon {
+		// The balloon starts deflated
+		exArgs = append(exArgs, "--balloon", "size=0,deflate_on_oom=on,free_page_reporting=on")
+	}
+	// Redirect the serial console of the guest to the monitor's stdio
+	exArgs = append(exArgs, "--console", "off", "--serial", "tty")
+
+	if args.TapDevice != "" {
+		netcli := ukernel.MonitorNetCli(chString)
+		if netcli == "" {
+			netcli = "--net tap="
+		}
+		netcli += args.TapDevice
+		if args.GuestMAC != "" {
+			netcli += ",mac=" + args.GuestMAC
+		}
+		exArgs = append(exArgs, strings.Fields(netcli)...)
+	}
+	if args.BlockDevice != "" {
+		blockCli := ukernel.MonitorBlockCli(chString)
+		if blockCli == "" {
+			blockCli = "--disk path="
+		}
+		blockCli += args.BlockDevice
+		exArgs = append(exArgs, strings.Fields(blockCli)...)
+	}
+	if args.ControlDir != "" {
+		apiSocket := filepath.Join(args.ControlDir, CloudHypervisorSocketName)
+		exArgs = append(exArgs, "--api-socket", "path="+apiSocket)
+	}
+	if !args.Seccomp {
+		exArgs = append(exArgs, "--seccomp", "false")
+	}
+	exArgs = append(exArgs, strings.Fields(ukernel.MonitorCli(chString))...)
+	exArgs = append(exArgs, args.ExtraArgs...)
+
+	return exArgs
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
+)
+
+func TestCloudHypervisorArgs(t *testing.T) {
+	ukernel, err := unikernels.New(unikernels.LinuxUnikernel)
+	assert.NoError(t, err)
+	ch := &CloudHypervisor{binary: CloudHypervisorBinary, binaryPath: "/usr/bin/cloud-hypervisor"}
+
+	tests := []struct {
+		name     string
+		args     ExecArgs
+		expected []string
+	}{
+		{
+			name: "minimal",
+			args: ExecArgs{
+				UnikernelPath: "/kernel",
+				Command:       "console=ttyS0 panic=-1",
+				Seccomp:       true,
+			},
+			expected: []string{"/usr/bin/cloud-hypervisor",
+				"--kernel", "/kernel",
+				"--cmdline", "console=ttyS0 panic=-1",
+				"--memory", "size=256M",
+				"--cpus", "boot=1",
+				"--console", "off", "--serial", "tty",
+			},
+		},
+		{
+			name: "all devices",
+			args: ExecArgs{
+				UnikernelPath: "/kernel",
+				InitrdPath:    "/initrd",
+				Command:       "console=ttyS0",
+				TapDevice:     "tap0_urunc",
+				GuestMAC:      "02:00:00:00:00:01",
+				BlockDevice:   "/dev/dm-1",
+				MemSizeB:      512 * 1024 * 1024,
+				VCPUs:         4,
+				HugePageSize:  2 * 1024 * 1024,
+				ControlDir:    MonitorControlDir,
+				Seccomp:       false,
+				Balloon:       true,
+				ExtraArgs:     []string{"--rng", "src=/dev/urandom"},
+			},
+			expected: []string{"/usr/bin/cloud-hypervisor",
+				"--kernel", "/kernel",
+				"--cmdline", "console=ttyS0",
+				"--initramfs", "/initrd",
+				"--memory", "size=512M,hugepages=on,hugepage_size=2M",
+				"--cpus", "boot=4",
+				"--balloon", "size=0,deflate_on_oom=on,free_page_reporting=on",
+				"--console", "off", "--serial", "tty",
+				"--net", "tap=tap0_urunc,mac=02:00:00:00:00:01",
+				"--disk", "path=/dev/dm-1",
+				"--api-socket", "path=/tmp/urunc/cloud-hypervisor.sock",
+				"--seccomp", "false",
+				"--rng", "src=/dev/urandom",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ch.buildArgs(tc.args, ukernel))
+		})
+	}
+}
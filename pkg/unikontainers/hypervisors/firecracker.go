@@ -15,20 +15,27 @@
 package hypervisors
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
+	"golang.org/x/sys/unix"
 )
 
 const (
 	FirecrackerVmm    VmmType = "firecracker"
 	FirecrackerBinary string  = "firecracker"
 	FCJsonFilename    string  = "fc.json"
+	// The FIFO, where Firecracker writes its metrics
+	FCMetricsFilename string = "fc.metrics"
+	// How often the guest updates the statistics of the balloon in seconds
+	fcBalloonStatsInterval = 1
 )
 
 type Firecracker struct {
@@ -47,6 +54,7 @@ type FirecrackerMachine struct {
 	MemSizeMiB      uint64 `json:"mem_size_mib"`
 	Smt             bool   `json:"smt"`
 	TrackDirtyPages bool   `json:"track_dirty_pages"`
+	HugePages       string `json:"huge_pages,omitempty"`
 }
 
 type FirecrackerDrive struct {
@@ -62,15 +70,177 @@ type FirecrackerNet struct {
 	HostIF   string `json:"host_dev_name"`
 }
 
+type FirecrackerBalloon struct {
+	AmountMiB             uint64 `json:"amount_mib"`
+	DeflateOnOOM          bool   `json:"deflate_on_oom"`
+	StatsPollingIntervalS int    `json:"stats_polling_interval_s"`
+}
+
+type FirecrackerMetrics struct {
+	Path string `json:"metrics_path"`
+}
+
 type FirecrackerConfig struct {
 	Source  FirecrackerBootSource `json:"boot-source"`
 	Machine FirecrackerMachine    `json:"machine-config"`
 	Drives  []FirecrackerDrive    `json:"drives"`
 	NetIfs  []FirecrackerNet      `json:"network-interfaces"`
+	Balloon *FirecrackerBalloon   `json:"balloon,omitempty"`
+	Metrics *FirecrackerMetrics   `json:"metrics,omitempty"`
 }
 
-func (fc *Firecracker) Stop(_ string) error {
-	return nil
+// Stop shuts down the guest gracefully and kills the monitor, if it does
+// not exit within args.Timeout.
+func (fc *Firecracker) Stop(args StopArgs) error {
+	return gracefulStop(args, fc.shutdown)
+}
+
+// shutdown sends a Ctrl+Alt+Del to the guest, if Firecracker runs in API
+// mode. Otherwise, or if the action is not available (it is x86 only),
+// we can only send SIGTERM to the monitor.
+func (fc *Firecracker) shutdown(args StopArgs) error {
+	socketPath := firecrackerSocketPath(args.BaseDir)
+	if _, err := os.Stat(socketPath); err == nil {
+		api := NewFirecrackerAPI(socketPath)
+		err = api.Action(FCActionSendCtrlAltDel)
+		if err == nil {
+			return nil
+		}
+		vmmLog.WithError(err).Warn("failed to send Ctrl+Alt+Del, sending SIGTERM to Firecracker")
+	}
+	return signalMonitor(args.Pid, syscall.SIGTERM)
+}
+
+// Pause pauses the microVM through the API, if Firecracker runs in API mode.
+// Otherwise, it falls back to the cgroup freezer.
+func (fc *Firecracker) Pause(args ControlArgs) error {
+	socketPath := firecrackerSocketPath(args.BaseDir)
+	if _, err := os.Stat(socketPath); err != nil {
+		return newCgroupFreezer().Freeze(args.Pid)
+	}
+	return NewFirecrackerAPI(socketPath).SetVMState(FCVMStatePaused)
+}
+
+// Resume resumes the microVM through the API, if Firecracker runs in API
+// mode. Otherwise, it falls back to the cgroup freezer.
+func (fc *Firecracker) Resume(args ControlArgs) error {
+	socketPath := firecrackerSocketPath(args.BaseDir)
+	if _, err := os.Stat(socketPath); err != nil {
+		return newCgroupFreezer().Thaw(args.Pid)
+	}
+	return NewFirecrackerAPI(socketPath).SetVMState(FCVMStateResumed)
+}
+
+// ResizeMemory sets the memory of the guest through the balloon device,
+// which is only available in API mode.
+func (fc *Firecracker) ResizeMemory(args ControlArgs, sizeB uint64) error {
+	socketPath := firecrackerSocketPath(args.BaseDir)
+	if _, err := os.Stat(socketPath); err != nil {
+		return fmt.Errorf("firecracker does not run in API mode")
+	}
+	memMiB := DefaultMemory
+	if args.MemSizeB != 0 {
+		memMiB = bytesToMiB(args.MemSizeB)
+	}
+	var amount uint64
+	if target := bytesToMiB(sizeB); target < memMiB {
+		amount = memMiB - target
+	}
+	return NewFirecrackerAPI(socketPath).SetBalloon(amount)
+}
+
+// BalloonStats returns the statistics of the balloon device, which are
+// only available in API mode.
+func (fc *Firecracker) BalloonStats(args ControlArgs) (*BalloonStats, error) {
+	socketPath := firecrackerSocketPath(args.BaseDir)
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, fmt.Errorf("firecracker does not run in API mode")
+	}
+	guestStats, err := NewFirecrackerAPI(socketPath).BalloonStats()
+	if err != nil {
+		return nil, err
+	}
+	return &BalloonStats{
+		Actual: guestStats["actual_mib"] * 1024 * 1024,
+		Guest:  guestStats,
+	}, nil
+}
+
+// VMStats returns the latest metrics of Firecracker, which it writes to a
+// FIFO in the control directory. In API mode, Firecracker flushes them on
+// request. Otherwise, it flushes them every minute. Most of the metrics
+// count the events since the previous flush.
+func (fc *Firecracker) VMStats(args ControlArgs) (map[string]uint64, error) {
+	metricsPath := firecrackerMetricsPath(args.BaseDir)
+	if _, err := os.Stat(metricsPath); err != nil {
+		return nil, fmt.Errorf("firecracker does not export its metrics")
+	}
+	// Firecracker keeps the FIFO open for both reading and writing, so
+	// neither opening nor reading it blocks
+	fd, err := unix.Open(metricsPath, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the metrics of firecracker: %w", err)
+	}
+	defer unix.Close(fd)
+
+	socketPath := firecrackerSocketPath(args.BaseDir)
+	if _, err := os.Stat(socketPath); err == nil {
+		err = NewFirecrackerAPI(socketPath).Action(FCActionFlushMetrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var data []byte
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := unix.Read(fd, buf)
+		if n > 0 {
+			data = append(data, buf[:n]...)
+			continue
+		}
+		if err != nil && err != unix.EAGAIN {
+			return nil, fmt.Errorf("failed to read the metrics of firecracker: %w", err)
+		}
+		break
+	}
+	return parseFirecrackerMetrics(data)
+}
+
+// parseFirecrackerMetrics parses the last complete line of the metrics that
+// Firecracker wrote. The nested metrics get flattened to "group.metric".
+func parseFirecrackerMetrics(data []byte) (map[string]uint64, error) {
+	lines := bytes.Split(data, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		decoder := json.NewDecoder(bytes.NewReader(lines[i]))
+		decoder.UseNumber()
+		var metrics map[string]any
+		if decoder.Decode(&metrics) != nil {
+			continue
+		}
+		stats := make(map[string]uint64)
+		flattenMetrics("", metrics, stats)
+		return stats, nil
+	}
+	return nil, fmt.Errorf("firecracker has not written any metrics yet")
+}
+
+// flattenMetrics adds the numbers in value to stats, named by their path in
+// the metrics
+func flattenMetrics(name string, value any, stats map[string]uint64) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, nested := range v {
+			if name != "" {
+				key = name + "." + key
+			}
+			flattenMetrics(key, nested, stats)
+		}
+	case json.Number:
+		number, err := strconv.ParseUint(v.String(), 10, 64)
+		if err == nil {
+			stats[name] = number
+		}
+	}
 }
 
 func (fc *Firecracker) Ok() error {
@@ -86,6 +256,11 @@ func (fc *Firecracker) SupportsSharedfs() bool {
 	return false
 }
 
+// SupportsPause returns a bool value depending on the monitor support for pause
+func (fc *Firecracker) SupportsPause() bool {
+	return true
+}
+
 func (fc *Firecracker) Path() string {
 	return fc.binaryPath
 }
@@ -97,13 +272,43 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 	// options in FC, since the string return value of the Monitor related
 	// functions in the unikernel interface do not integrate well with FC's
 	// json configuration.
-	cmdString := fc.Path() + " --no-api --config-file "
-	JSONConfigFile := filepath.Join("/tmp/", FCJsonFilename)
-	cmdString += JSONConfigFile
+	var cmdString string
+	var JSONConfigFile string
+	if args.WithAPI && args.ControlDir != "" {
+		// In API mode, urunc configures the VM through the API socket
+		// using the config we store in the control directory.
+		cmdString = fc.Path() + " --api-sock " + filepath.Join(args.ControlDir, FirecrackerSocketName)
+		JSONConfigFile = filepath.Join(args.ControlDir, FCJsonFilename)
+	} else {
+		JSONConfigFile = filepath.Join("/tmp/", FCJsonFilename)
+		cmdString = fc.Path() + " --no-api --config-file " + JSONConfigFile
+	}
 	if !args.Seccomp {
 		cmdString += " --no-seccomp"
 	}
 
+	FCConfig := fc.buildConfig(args)
+	if FCConfig.Metrics != nil {
+		err := unix.Mkfifo(FCConfig.Metrics.Path, 0o600)
+		if err != nil && err != unix.EEXIST {
+			return fmt.Errorf("failed to create the metrics FIFO of Firecracker: %w", err)
+		}
+	}
+	FCConfigJSON, _ := json.Marshal(FCConfig)
+	if err := os.WriteFile(JSONConfigFile, FCConfigJSON, 0o644); err != nil { //nolint: gosec
+		return fmt.Errorf("failed to save Firecracker json config: %w", err)
+	}
+	vmmLog.WithField("Json", string(FCConfigJSON)).Debug("Firecracker json config")
+
+	exArgs := strings.Split(cmdString, " ")
+	exArgs = append(exArgs, args.ExtraArgs...)
+	vmmLog.WithField("Firecracker command", exArgs).Debug("Ready to execve Firecracker")
+
+	return syscall.Exec(fc.Path(), exArgs, args.Environment) //nolint: gosec
+}
+
+// buildConfig creates the VM configuration for Firecracker
+func (fc *Firecracker) buildConfig(args ExecArgs) *FirecrackerConfig {
 	// VM config for Firecracker
 	fcMem := DefaultMemory
 	if args.MemSizeB != 0 {
@@ -114,11 +319,20 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 		}
 	}
 	FCMachine := FirecrackerMachine{
-		VcpuCount:       1, // TODO: Use value from configuration or Environment variable
+		VcpuCount:       vcpuCount(args),
 		MemSizeMiB:      fcMem,
 		Smt:             false,
 		TrackDirtyPages: false,
 	}
+	if args.HugePageSize != 0 {
+		// Firecracker supports only 2M hugepages
+		hugePages := hugePageSizeString(args.HugePageSize)
+		if hugePages == "2M" {
+			FCMachine.HugePages = hugePages
+		} else {
+			vmmLog.Warnf("firecracker does not support %s hugepages, the guest memory will use regular pages", hugePages)
+		}
+	}
 
 	// Net config for Firecracker
 	FCNet := make([]FirecrackerNet, 0)
@@ -147,20 +361,29 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 		BootArgs:   args.Command,
 		InitrdPath: args.InitrdPath,
 	}
-	FCConfig := &FirecrackerConfig{
+	// The balloon starts deflated and the guest can reclaim its memory
+	// under memory pressure
+	var FCBalloon *FirecrackerBalloon
+	if args.Balloon {
+		FCBalloon = &FirecrackerBalloon{
+			AmountMiB:             0,
+			DeflateOnOOM:          true,
+			StatsPollingIntervalS: fcBalloonStatsInterval,
+		}
+	}
+	// Firecracker writes its metrics to a FIFO, which urunc reads
+	var FCMetrics *FirecrackerMetrics
+	if args.VMMetrics && args.ControlDir != "" {
+		FCMetrics = &FirecrackerMetrics{
+			Path: filepath.Join(args.ControlDir, FCMetricsFilename),
+		}
+	}
+	return &FirecrackerConfig{
 		Source:  FCSource,
 		Machine: FCMachine,
 		Drives:  FCDrives,
 		NetIfs:  FCNet,
+		Balloon: FCBalloon,
+		Metrics: FCMetrics,
 	}
-	FCConfigJSON, _ := json.Marshal(FCConfig)
-	if err := os.WriteFile(JSONConfigFile, FCConfigJSON, 0o644); err != nil { //nolint: gosec
-		return fmt.Errorf("failed to save Firecracker json config: %w", err)
-	}
-	vmmLog.WithField("Json", string(FCConfigJSON)).Debug("Firecracker json config")
-
-	exArgs := strings.Split(cmdString, " ")
-	vmmLog.WithField("Firecracker command", exArgs).Debug("Ready to execve Firecracker")
-
-	return syscall.Exec(fc.Path(), exArgs, args.Environment) //nolint: gosec
 }
@@ -0,0 +1,196 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	FirecrackerSocketName = "firecracker.sock"
+	fcAPITimeout          = 5 * time.Second
+	// How long to wait for the API socket of Firecracker to appear
+	fcSocketTimeout = 10 * time.Second
+
+	FCActionInstanceStart  = "InstanceStart"
+	FCActionSendCtrlAltDel = "SendCtrlAltDel"
+	FCActionFlushMetrics   = "FlushMetrics"
+
+	FCVMStatePaused  = "Paused"
+	FCVMStateResumed = "Resumed"
+)
+
+// FirecrackerAPI is a client for the HTTP API that Firecracker serves over
+// a unix socket.
+type FirecrackerAPI struct {
+	client *unixHTTPClient
+}
+
+type firecrackerAction struct {
+	ActionType string `json:"action_type"`
+}
+
+type firecrackerVMState struct {
+	State string `json:"state"`
+}
+
+type firecrackerBalloonUpdate struct {
+	AmountMiB uint64 `json:"amount_mib"`
+}
+
+// NewFirecrackerAPI returns a client for the Firecracker API socket at
+// socketPath. It does not connect to the socket.
+func NewFirecrackerAPI(socketPath string) *FirecrackerAPI {
+	return &FirecrackerAPI{client: newUnixHTTPClient(socketPath, fcAPITimeout)}
+}
+
+// Configure pushes the whole VM configuration to Firecracker. It should be
+// called before starting the instance.
+func (api *FirecrackerAPI) Configure(config *FirecrackerConfig) error {
+	err := api.client.request(http.MethodPut, "/boot-source", config.Source)
+	if err != nil {
+		return err
+	}
+	err = api.client.request(http.MethodPut, "/machine-config", config.Machine)
+	if err != nil {
+		return err
+	}
+	for _, drive := range config.Drives {
+		err = api.client.request(http.MethodPut, "/drives/"+drive.DriveID, drive)
+		if err != nil {
+			return err
+		}
+	}
+	for _, netIf := range config.NetIfs {
+		if netIf.HostIF == "" {
+			continue
+		}
+		err = api.client.request(http.MethodPut, "/network-interfaces/"+netIf.IfaceID, netIf)
+		if err != nil {
+			return err
+		}
+	}
+	if config.Balloon != nil {
+		err = api.client.request(http.MethodPut, "/balloon", config.Balloon)
+		if err != nil {
+			return err
+		}
+	}
+	if config.Metrics != nil {
+		err = api.client.request(http.MethodPut, "/metrics", config.Metrics)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Action performs one of the Firecracker actions (e.g. InstanceStart)
+func (api *FirecrackerAPI) Action(actionType string) error {
+	return api.client.request(http.MethodPut, "/actions", firecrackerAction{ActionType: actionType})
+}
+
+// SetVMState pauses or resumes the microVM
+func (api *FirecrackerAPI) SetVMState(state string) error {
+	return api.client.request(http.MethodPatch, "/vm", firecrackerVMState{State: state})
+}
+
+// SetBalloon sets the target size of the balloon device in MiB, which is
+// the memory that the guest has to give back to the host
+func (api *FirecrackerAPI) SetBalloon(amountMiB uint64) error {
+	return api.client.request(http.MethodPatch, "/balloon", firecrackerBalloonUpdate{AmountMiB: amountMiB})
+}
+
+// BalloonStats returns the statistics of the balloon device. All of them
+// are counters or sizes, in pages, MiB or bytes, as named by Firecracker.
+func (api *FirecrackerAPI) BalloonStats() (map[string]uint64, error) {
+	data, err := api.client.do(http.MethodGet, "/balloon/statistics", nil)
+	if err != nil {
+		return nil, err
+	}
+	var stats map[string]uint64
+	err = json.Unmarshal(data, &stats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the balloon statistics: %w", err)
+	}
+	return stats, nil
+}
+
+// WaitReady waits until the API socket accepts connections
+func (api *FirecrackerAPI) WaitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := api.client.request(http.MethodGet, "/", nil)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("firecracker API is not ready: %w", err)
+		}
+		time.Sleep(exitPollInterval)
+	}
+}
+
+// firecrackerSocketPath returns the path of the API socket of a container,
+// as seen by urunc.
+func firecrackerSocketPath(baseDir string) string {
+	return filepath.Join(baseDir, ControlDirName, FirecrackerSocketName)
+}
+
+// firecrackerMetricsPath returns the path of the FIFO, where Firecracker
+// writes its metrics, as seen by urunc.
+func firecrackerMetricsPath(baseDir string) string {
+	return filepath.Join(baseDir, ControlDirName, FCMetricsFilename)
+}
+
+// firecrackerConfigPath returns the path of the VM configuration, which
+// urunc pushes to Firecracker through the API, as seen by urunc.
+func firecrackerConfigPath(baseDir string) string {
+	return filepath.Join(baseDir, ControlDirName, FCJsonFilename)
+}
+
+// ConfigureVM configures a Firecracker VM, which runs in API mode, and
+// starts the instance. It reads the configuration that Execve stored in the
+// control directory.
+func (fc *Firecracker) ConfigureVM(baseDir string) error {
+	// The configuration is stored right before Firecracker starts and
+	// hence it is available once the API socket is ready.
+	api := NewFirecrackerAPI(firecrackerSocketPath(baseDir))
+	err := api.WaitReady(fcSocketTimeout)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(firecrackerConfigPath(baseDir))
+	if err != nil {
+		return fmt.Errorf("failed to read Firecracker config: %w", err)
+	}
+	var config FirecrackerConfig
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return fmt.Errorf("failed to parse Firecracker config: %w", err)
+	}
+
+	err = api.Configure(&config)
+	if err != nil {
+		return err
+	}
+	return api.Action(FCActionInstanceStart)
+}
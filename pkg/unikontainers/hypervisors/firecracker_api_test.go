@@ -0,0 +1,238 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+type fcRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// fakeFirecrackerAPI serves a fake Firecracker API on a unix socket and
+// records every request it receives.
+type fakeFirecrackerAPI struct {
+	mu       sync.Mutex
+	requests []fcRequest
+	// Requests to the paths in fail get a 400 response
+	fail map[string]bool
+	// GET requests to the paths in responses get the respective body
+	responses map[string]string
+}
+
+func newFakeFirecrackerAPI(t *testing.T, socketPath string) *fakeFirecrackerAPI {
+	f := &fakeFirecrackerAPI{fail: map[string]bool{}, responses: map[string]string{}}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socketPath, err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(f.handle))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return f
+}
+
+func (f *fakeFirecrackerAPI) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodGet {
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, f.responses[r.URL.Path])
+		return
+	}
+	f.requests = append(f.requests, fcRequest{Method: r.Method, Path: r.URL.Path, Body: string(body)})
+	if f.fail[r.URL.Path] {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(apiFault{FaultMessage: "invalid request"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeFirecrackerAPI) received() []fcRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fcRequest{}, f.requests...)
+}
+
+func TestFirecrackerConfigureVM(t *testing.T) {
+	baseDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(baseDir, ControlDirName), 0o700))
+	api := newFakeFirecrackerAPI(t, firecrackerSocketPath(baseDir))
+
+	fc := &Firecracker{}
+	config := fc.buildConfig(ExecArgs{
+		UnikernelPath: "/unikernel",
+		Command:       "console=ttyS0",
+		TapDevice:     "tap0_urunc",
+		GuestMAC:      "02:00:00:00:00:01",
+		BlockDevice:   "/dev/dm-1",
+		MemSizeB:      512 * 1024 * 1024,
+		VCPUs:         2,
+		HugePageSize:  2 * 1024 * 1024,
+	})
+	data, err := json.Marshal(config)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(firecrackerConfigPath(baseDir), data, 0o600))
+
+	assert.NoError(t, fc.ConfigureVM(baseDir))
+	expected := []fcRequest{
+		{http.MethodPut, "/boot-source", `{"kernel_image_path":"/unikernel","boot_args":"console=ttyS0"}`},
+		{http.MethodPut, "/machine-config", `{"vcpu_count":2,"mem_size_mib":512,"smt":false,"track_dirty_pages":false,"huge_pages":"2M"}`},
+		{http.MethodPut, "/drives/rootfs", `{"drive_id":"rootfs","is_read_only":false,"is_root_device":true,"path_on_host":"/dev/dm-1"}`},
+		{http.MethodPut, "/network-interfaces/net1", `{"iface_id":"net1","guest_mac":"02:00:00:00:00:01","host_dev_name":"tap0_urunc"}`},
+		{http.MethodPut, "/actions", `{"action_type":"InstanceStart"}`},
+	}
+	assert.Equal(t, expected, api.received())
+}
+
+func TestFirecrackerAPIError(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), FirecrackerSocketName)
+	api := newFakeFirecrackerAPI(t, socketPath)
+	api.fail["/actions"] = true
+
+	err := NewFirecrackerAPI(socketPath).Action(FCActionInstanceStart)
+	assert.ErrorContains(t, err, "invalid request")
+}
+
+func TestFirecrackerShutdown(t *testing.T) {
+	baseDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(baseDir, ControlDirName), 0o700))
+	api := newFakeFirecrackerAPI(t, firecrackerSocketPath(baseDir))
+
+	fc := &Firecracker{}
+	assert.NoError(t, fc.shutdown(StopArgs{Container: "test", BaseDir: baseDir}))
+	expected := []fcRequest{
+		{http.MethodPut, "/actions", `{"action_type":"SendCtrlAltDel"}`},
+	}
+	assert.Equal(t, expected, api.received())
+}
+
+func TestFirecrackerPauseResume(t *testing.T) {
+	baseDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(baseDir, ControlDirName), 0o700))
+	api := newFakeFirecrackerAPI(t, firecrackerSocketPath(baseDir))
+
+	fc := &Firecracker{}
+	args := ControlArgs{Container: "test", BaseDir: baseDir}
+	assert.NoError(t, fc.Pause(args))
+	assert.NoError(t, fc.Resume(args))
+	expected := []fcRequest{
+		{http.MethodPatch, "/vm", `{"state":"Paused"}`},
+		{http.MethodPatch, "/vm", `{"state":"Resumed"}`},
+	}
+	assert.Equal(t, expected, api.received())
+}
+
+func TestFirecrackerResizeMemory(t *testing.T) {
+	baseDir := t.TempDir()
+	fc := &Firecracker{}
+	args := ControlArgs{Container: "test", BaseDir: baseDir, MemSizeB: 512 * 1024 * 1024}
+	// The balloon is only available in API mode
+	assert.Error(t, fc.ResizeMemory(args, 256*1024*1024))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(baseDir, ControlDirName), 0o700))
+	api := newFakeFirecrackerAPI(t, firecrackerSocketPath(baseDir))
+	assert.NoError(t, fc.ResizeMemory(args, 384*1024*1024))
+	// The guest can not get more memory than it booted with
+	assert.NoError(t, fc.ResizeMemory(args, 1024*1024*1024))
+	expected := []fcRequest{
+		{http.MethodPatch, "/balloon", `{"amount_mib":128}`},
+		{http.MethodPatch, "/balloon", `{"amount_mib":0}`},
+	}
+	assert.Equal(t, expected, api.received())
+}
+
+func TestFirecrackerBalloon(t *testing.T) {
+	baseDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(baseDir, ControlDirName), 0o700))
+	api := newFakeFirecrackerAPI(t, firecrackerSocketPath(baseDir))
+	api.responses["/balloon/statistics"] = `{"target_mib":0,"actual_mib":256,"free_memory":134217728}`
+
+	fc := &Firecracker{}
+	config := fc.buildConfig(ExecArgs{UnikernelPath: "/unikernel", Command: "console=ttyS0", Balloon: true})
+	assert.NoError(t, NewFirecrackerAPI(firecrackerSocketPath(baseDir)).Configure(config))
+	assert.Contains(t, api.received(),
+		fcRequest{http.MethodPut, "/balloon", `{"amount_mib":0,"deflate_on_oom":true,"stats_polling_interval_s":1}`})
+
+	stats, err := fc.BalloonStats(ControlArgs{Container: "test", BaseDir: baseDir})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(256*1024*1024), stats.Actual)
+	assert.Equal(t, uint64(134217728), stats.Guest["free_memory"])
+}
+
+func TestFirecrackerVMStats(t *testing.T) {
+	baseDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(baseDir, ControlDirName), 0o700))
+	api := newFakeFirecrackerAPI(t, firecrackerSocketPath(baseDir))
+
+	fc := &Firecracker{}
+	config := fc.buildConfig(ExecArgs{UnikernelPath: "/unikernel", ControlDir: MonitorControlDir, VMMetrics: true})
+	assert.NoError(t, NewFirecrackerAPI(firecrackerSocketPath(baseDir)).Configure(config))
+	assert.Contains(t, api.received(), fcRequest{http.MethodPut, "/metrics", `{"metrics_path":"/tmp/urunc/fc.metrics"}`})
+
+	_, err := fc.VMStats(ControlArgs{Container: "test", BaseDir: baseDir})
+	assert.ErrorContains(t, err, "does not export its metrics")
+
+	// Firecracker opens the FIFO for both reading and writing
+	metricsPath := firecrackerMetricsPath(baseDir)
+	assert.NoError(t, unix.Mkfifo(metricsPath, 0o600))
+	fifo, err := os.OpenFile(metricsPath, os.O_RDWR, 0)
+	assert.NoError(t, err)
+	defer fifo.Close()
+	_, err = fifo.WriteString(`{"utc_timestamp_ms":1,"vcpu":{"exit_io_in":1}}` + "\n" +
+		`{"utc_timestamp_ms":2,"vcpu":{"exit_io_in":5,"exit_mmio_read":3},"api_server":{"sync_vmm_send_timeout_count":0},"logger":{"missed_metrics_count":"n/a"}}` + "\n")
+	assert.NoError(t, err)
+
+	stats, err := fc.VMStats(ControlArgs{Container: "test", BaseDir: baseDir})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{
+		"utc_timestamp_ms":                       2,
+		"vcpu.exit_io_in":                        5,
+		"vcpu.exit_mmio_read":                    3,
+		"api_server.sync_vmm_send_timeout_count": 0,
+	}, stats)
+	assert.Contains(t, api.received(), fcRequest{http.MethodPut, "/actions", `{"action_type":"FlushMetrics"}`})
+
+	// The FIFO is empty after a read
+	_, err = fc.VMStats(ControlArgs{Container: "test", BaseDir: baseDir})
+	assert.ErrorContains(t, err, "has not written any metrics")
+}
+
+func TestParseFirecrackerMetrics(t *testing.T) {
+	// A partial line, which Firecracker did not finish writing, is skipped
+	stats, err := parseFirecrackerMetrics([]byte(`{"net":{"tx_bytes_count":10}}` + "\n" + `{"net":{"tx_by`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"net.tx_bytes_count": 10}, stats)
+
+	_, err = parseFirecrackerMetrics(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cgroupRoot       = "/sys/fs/cgroup"
+	freezeTimeout    = 2 * time.Second
+	procCgroupFormat = "/proc/%d/cgroup"
+)
+
+// cgroupFreezer pauses and resumes the monitor process through the freezer
+// of its cgroup. It is the fallback for monitors without a control channel.
+// If the monitor shares its cgroup with other processes, it gets stopped
+// with SIGSTOP instead.
+type cgroupFreezer struct {
+	// The root of the cgroup hierarchies and the place to look for the
+	// cgroup of the monitor. They can change for testing purposes.
+	root          string
+	procCgroupFmt string
+}
+
+func newCgroupFreezer() *cgroupFreezer {
+	return &cgroupFreezer{
+		root:          cgroupRoot,
+		procCgroupFmt: procCgroupFormat,
+	}
+}
+
+// Freeze freezes the cgroup of the process with the given pid
+func (f *cgroupFreezer) Freeze(pid int) error {
+	return f.setState(pid, true)
+}
+
+// Thaw thaws the cgroup of the process with the given pid
+func (f *cgroupFreezer) Thaw(pid int) error {
+	return f.setState(pid, false)
+}
+
+func (f *cgroupFreezer) setState(pid int, frozen bool) error {
+	dir, v2, err := f.cgroupDir(pid)
+	if err != nil {
+		return err
+	}
+
+	// The freezer acts on the whole cgroup. Make sure that we will not
+	// freeze anything other than the monitor (e.g. the shim). Otherwise,
+	// stop the monitor with a signal instead.
+	procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return fmt.Errorf("failed to read the processes of cgroup %s: %w", dir, err)
+	}
+	if strings.TrimSpace(string(procs)) != strconv.Itoa(pid) {
+		vmmLog.WithField("cgroup", dir).Debug("the cgroup of the monitor is shared, pausing it with signals")
+		return stopProcess(pid, frozen)
+	}
+
+	// Freezing completes asynchronously, so we need to check when the
+	// cgroup has actually reached the requested state.
+	var stateFile, state, checkFile, expected string
+	switch {
+	case v2 && frozen:
+		stateFile, state, checkFile, expected = "cgroup.freeze", "1", "cgroup.events", "frozen 1"
+	case v2:
+		stateFile, state, checkFile, expected = "cgroup.freeze", "0", "cgroup.events", "frozen 0"
+	case frozen:
+		stateFile, state, checkFile, expected = "freezer.state", "FROZEN", "freezer.state", "FROZEN"
+	default:
+		stateFile, state, checkFile, expected = "freezer.state", "THAWED", "freezer.state", "THAWED"
+	}
+	err = os.WriteFile(filepath.Join(dir, stateFile), []byte(state), 0o644) //nolint: gosec
+	if err != nil {
+		return fmt.Errorf("failed to write %s to %s: %w", state, stateFile, err)
+	}
+
+	checkFile = filepath.Join(dir, checkFile)
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		data, err := os.ReadFile(checkFile)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), expected) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for cgroup %s to reach state %s", dir, state)
+		}
+		time.Sleep(exitPollInterval)
+	}
+}
+
+// stopProcess stops the process with the given pid with SIGSTOP, or resumes
+// it with SIGCONT, and waits until it reaches the requested state. The
+// stopped monitor can not run any vCPU, so the guest gets paused.
+func stopProcess(pid int, stop bool) error {
+	sig := syscall.SIGCONT
+	if stop {
+		sig = syscall.SIGSTOP
+	}
+	err := syscall.Kill(pid, sig)
+	if err != nil {
+		return fmt.Errorf("failed to send %s to the monitor: %w", unix.SignalName(sig), err)
+	}
+
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		state, _, err := readProcStat(pid)
+		if err != nil {
+			return err
+		}
+		if state == "Z" || state == "X" {
+			return fmt.Errorf("monitor process %d has exited", pid)
+		}
+		if (state == "T") == stop {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for process %d to get %s", pid, unix.SignalName(sig))
+		}
+		time.Sleep(exitPollInterval)
+	}
+}
+
+// cgroupDir returns the directory of the freezer cgroup of a process and
+// whether it is a cgroup v2 one.
+func (f *cgroupFreezer) cgroupDir(pid int) (string, bool, error) {
+	file, err := os.Open(fmt.Sprintf(f.procCgroupFmt, pid))
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+
+	var unified string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Each line has the format hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "freezer" {
+				return filepath.Join(f.root, "freezer", parts[2]), false, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", false, err
+	}
+	if unified != "" {
+		return filepath.Join(f.root, unified), true, nil
+	}
+	return "", false, fmt.Errorf("could not find the freezer cgroup of process %d", pid)
+}
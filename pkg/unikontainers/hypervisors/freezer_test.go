@@ -0,0 +1,107 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPid = 4242
+
+// newTestFreezer creates a fake cgroup hierarchy and a fake /proc/<pid>/cgroup
+// file with the given contents.
+func newTestFreezer(t *testing.T, procCgroup string, cgroupDir string, procs string) *cgroupFreezer {
+	root := t.TempDir()
+	proc := t.TempDir()
+	procFile := filepath.Join(proc, strconv.Itoa(testPid), "cgroup")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(procFile), 0o755))
+	assert.NoError(t, os.WriteFile(procFile, []byte(procCgroup), 0o644))
+	dir := filepath.Join(root, cgroupDir)
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(procs), 0o644))
+	return &cgroupFreezer{
+		root:          root,
+		procCgroupFmt: filepath.Join(proc, "%d", "cgroup"),
+	}
+}
+
+func TestFreezerV2(t *testing.T) {
+	f := newTestFreezer(t, "0::/urunc/test\n", "urunc/test", "4242\n")
+	dir := filepath.Join(f.root, "urunc/test")
+
+	// The kernel updates cgroup.events, so fake its response
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 1\n"), 0o644))
+	assert.NoError(t, f.Freeze(testPid))
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.freeze"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(data))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 0\n"), 0o644))
+	assert.NoError(t, f.Thaw(testPid))
+	data, err = os.ReadFile(filepath.Join(dir, "cgroup.freeze"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0", string(data))
+}
+
+func TestFreezerV1(t *testing.T) {
+	procCgroup := "12:memory:/urunc/test\n11:freezer:/urunc/test\n0::/\n"
+	f := newTestFreezer(t, procCgroup, "freezer/urunc/test", "4242\n")
+	stateFile := filepath.Join(f.root, "freezer/urunc/test/freezer.state")
+
+	assert.NoError(t, f.Freeze(testPid))
+	data, err := os.ReadFile(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "FROZEN", string(data))
+
+	assert.NoError(t, f.Thaw(testPid))
+	data, err = os.ReadFile(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "THAWED", string(data))
+}
+
+func TestFreezerSharedCgroup(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	assert.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	pid := cmd.Process.Pid
+
+	f := newTestFreezer(t, "0::/system.slice/containerd.service\n", "system.slice/containerd.service", "100\n4242\n")
+	procFile := fmt.Sprintf(f.procCgroupFmt, pid)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(procFile), 0o755))
+	assert.NoError(t, os.WriteFile(procFile, []byte("0::/system.slice/containerd.service\n"), 0o644))
+
+	// The monitor gets stopped, instead of the whole cgroup
+	assert.NoError(t, f.Freeze(pid))
+	_, err := os.Stat(filepath.Join(f.root, "system.slice/containerd.service/cgroup.freeze"))
+	assert.True(t, os.IsNotExist(err), "Expected the cgroup to remain untouched")
+	state, _, err := readProcStat(pid)
+	assert.NoError(t, err)
+	assert.Equal(t, "T", state)
+
+	assert.NoError(t, f.Thaw(pid))
+	state, _, err = readProcStat(pid)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "T", state)
+}
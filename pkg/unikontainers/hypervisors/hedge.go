@@ -16,25 +16,83 @@ package hypervisors
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	hedge "github.com/nubificus/hedge_cli/hedge_api"
 	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
 )
 
 const (
-	HedgeVmm         VmmType = "hedge"
-	maxVMListRetries int     = 20
-	ConsoleEndpoint          = "/proc/vmcons"
+	HedgeVmm          VmmType = "hedge"
+	maxVMListRetries  int     = 20
+	ConsoleEndpoint           = "/proc/vmcons"
+	hedgePollInterval         = 100 * time.Millisecond
 )
 
-type Hedge struct{}
+// hedgeAPI is the subset of the hedge_cli API that urunc uses. It allows
+// us to replace the kernel interface of Hedge in tests.
+type hedgeAPI interface {
+	Status() error
+	StartVM(conf hedge.VMConfig) error
+	StopVM(name string) error
+	ListVMs() ([]hedge.VM, error)
+	Console(id int) (string, error)
+}
+
+// hedgeCLI implements hedgeAPI on top of the procfs interface of Hedge
+type hedgeCLI struct{}
+
+func (hedgeCLI) Status() error                     { return hedge.Status() }
+func (hedgeCLI) StartVM(conf hedge.VMConfig) error { return hedge.StartVM(conf) }
+func (hedgeCLI) StopVM(name string) error          { return hedge.StopVM(name) }
+func (hedgeCLI) ListVMs() ([]hedge.VM, error)      { return hedge.ListVMs() }
+func (hedgeCLI) Console(id int) (string, error)    { return hedge.Console(id) }
+
+// Hedge runs the VMs inside the host kernel and hence there is no monitor
+// process. Instead, the reexec process starts the VM, streams its console
+// and exits when the VM stops, acting as the monitor of the VM.
+type Hedge struct {
+	api hedgeAPI
+}
+
+// client returns the hedge API, defaulting to the procfs interface
+func (h *Hedge) client() hedgeAPI {
+	if h.api == nil {
+		return hedgeCLI{}
+	}
+	return h.api
+}
 
 func (h *Hedge) Ok() error {
-	return fmt.Errorf("hedge not implemented yet")
+	return h.client().Status()
+}
+
+// Stop stops the VM and waits for the reexec process to exit. If it does
+// not exit within args.Timeout, it gets killed.
+func (h *Hedge) Stop(args StopArgs) error {
+	return gracefulStop(args, h.shutdown)
+}
+
+// shutdown stops the VM with the name of the container. Hedge does not
+// support a graceful shutdown of the guest.
+func (h *Hedge) shutdown(args StopArgs) error {
+	err := h.client().StopVM(args.Container)
+	if err != nil {
+		return fmt.Errorf("failed to stop hedge vm %s: %w", args.Container, err)
+	}
+	return nil
 }
 
-func (h *Hedge) Stop(_ string) error {
-	return fmt.Errorf("hedge not implemented yet")
+func (h *Hedge) Pause(_ ControlArgs) error {
+	return fmt.Errorf("hedge does not support pause")
+}
+
+func (h *Hedge) Resume(_ ControlArgs) error {
+	return fmt.Errorf("hedge does not support pause")
 }
 
 func (h *Hedge) UsesKVM() bool {
@@ -46,23 +104,152 @@ func (h *Hedge) SupportsSharedfs() bool {
 	return false
 }
 
+// SupportsPause returns a bool value depending on the monitor support for pause
+func (h *Hedge) SupportsPause() bool {
+	return false
+}
+
+// Path returns an empty string, since Hedge does not have a monitor binary
 func (h *Hedge) Path() string {
 	return ""
 }
 
-func (h *Hedge) Execve(_ ExecArgs, _ unikernels.Unikernel) error {
-	return fmt.Errorf("hedge not implemented yet")
+// Execve starts the VM and streams its console to stdout, until the VM
+// stops. A SIGTERM or SIGINT stops the VM.
+func (h *Hedge) Execve(args ExecArgs, _ unikernels.Unikernel) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigs)
+
+	if len(args.ExtraArgs) > 0 {
+		vmmLog.Warn("hedge does not support extra arguments, ignoring them")
+	}
+	id, err := h.startVM(args)
+	if err != nil {
+		return err
+	}
+	return h.monitor(args.Container, id, os.Stdout, sigs)
 }
 
-func (h *Hedge) VMState(name string) string {
-	vms, err := hedge.ListVMs()
+// buildConfig creates the configuration of the Hedge VM
+func (h *Hedge) buildConfig(args ExecArgs) hedge.VMConfig {
+	hedgeMem := DefaultMemory
+	if args.MemSizeB != 0 {
+		hedgeMem = bytesToMiB(args.MemSizeB)
+		// Check if memory is too small
+		if hedgeMem == 0 {
+			hedgeMem = DefaultMemory
+		}
+	}
+	return hedge.VMConfig{
+		Name:    args.Container,
+		Binary:  args.UnikernelPath,
+		CPU:     0,
+		Mem:     int(hedgeMem), //nolint: gosec
+		Blk:     args.BlockDevice,
+		Net:     args.TapDevice,
+		CmdLine: args.Command,
+	}
+}
+
+// startVM starts a new VM and returns the ID that Hedge assigned to it
+func (h *Hedge) startVM(args ExecArgs) (int, error) {
+	api := h.client()
+	conf := h.buildConfig(args)
+	// Hedge runs every VM on a single physical core
+	warnNoSMP(string(HedgeVmm), args)
+	warnNoHugepages(string(HedgeVmm), args)
+	warnNoBalloon(string(HedgeVmm), args)
+	vmmLog.WithField("hedge config", conf).Debug("Ready to start hedge vm")
+	err := api.StartVM(conf)
 	if err != nil {
-		return "error"
+		return 0, fmt.Errorf("failed to start hedge vm %s: %w", conf.Name, err)
+	}
+
+	// The VM does not appear in the list immediately
+	for i := 0; i < maxVMListRetries; i++ {
+		vm, err := h.findVM(conf.Name)
+		if err != nil {
+			return 0, err
+		}
+		if vm != nil {
+			return vm.ID, nil
+		}
+		time.Sleep(hedgePollInterval)
+	}
+	return 0, fmt.Errorf("hedge vm %s did not appear in the list of vms", conf.Name)
+}
+
+// findVM returns the VM with the given name or nil, if there is no such VM
+func (h *Hedge) findVM(name string) (*hedge.VM, error) {
+	vms, err := h.client().ListVMs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hedge vms: %w", err)
 	}
 	for _, vm := range vms {
 		if vm.Name == name {
-			return "running"
+			return &vm, nil
+		}
+	}
+	return nil, nil
+}
+
+// monitor copies the new output of the console of the VM to out, until the
+// VM stops. A signal in sigs stops the VM.
+func (h *Hedge) monitor(name string, id int, out io.Writer, sigs <-chan os.Signal) error {
+	api := h.client()
+	ticker := time.NewTicker(hedgePollInterval)
+	defer ticker.Stop()
+
+	written := 0
+	for {
+		select {
+		case sig := <-sigs:
+			vmmLog.WithField("signal", sig).Debug("Stopping hedge vm")
+			err := api.StopVM(name)
+			if err != nil {
+				vmmLog.WithError(err).Error("failed to stop hedge vm")
+			}
+		case <-ticker.C:
+		}
+
+		vm, err := h.findVM(name)
+		if err != nil {
+			return err
+		}
+
+		console, err := api.Console(id)
+		if err != nil {
+			// The console goes away along with the VM
+			if vm != nil {
+				vmmLog.WithError(err).Warn("failed to read the console of hedge vm")
+			}
+		} else {
+			if len(console) < written {
+				// The console buffer of the VM has wrapped around
+				written = 0
+			}
+			_, err = io.WriteString(out, console[written:])
+			if err != nil {
+				return err
+			}
+			written = len(console)
+		}
+
+		if vm == nil {
+			return nil
 		}
 	}
+}
+
+// VMState returns "running" if the VM with the given name exists
+func (h *Hedge) VMState(name string) string {
+	vm, err := h.findVM(name)
+	if err != nil {
+		return "error"
+	}
+	if vm != nil {
+		return "running"
+	}
 	return "unknown"
 }
@@ -0,0 +1,165 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	hedge "github.com/nubificus/hedge_cli/hedge_api"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHedgeAPI keeps the VMs in memory. The console of every VM grows by
+// one line, each time it gets read.
+type fakeHedgeAPI struct {
+	mu      sync.Mutex
+	nextID  int
+	vms     []hedge.VM
+	started []hedge.VMConfig
+	stopped []string
+	reads   map[int]int
+}
+
+func newFakeHedgeAPI() *fakeHedgeAPI {
+	return &fakeHedgeAPI{reads: map[int]int{}}
+}
+
+func (f *fakeHedgeAPI) Status() error {
+	return nil
+}
+
+func (f *fakeHedgeAPI) StartVM(conf hedge.VMConfig) error {
+	err := conf.Validate()
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.started = append(f.started, conf)
+	f.vms = append(f.vms, hedge.VM{ID: f.nextID, Name: conf.Name})
+	f.nextID++
+	return nil
+}
+
+func (f *fakeHedgeAPI) StopVM(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, vm := range f.vms {
+		if vm.Name == name {
+			f.vms = append(f.vms[:i], f.vms[i+1:]...)
+			f.stopped = append(f.stopped, name)
+			return nil
+		}
+	}
+	return fmt.Errorf("vm %s not found", name)
+}
+
+func (f *fakeHedgeAPI) ListVMs() ([]hedge.VM, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]hedge.VM{}, f.vms...), nil
+}
+
+func (f *fakeHedgeAPI) Console(id int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, vm := range f.vms {
+		if vm.ID == id {
+			f.reads[id]++
+			return strings.Repeat("line\n", f.reads[id]), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+func TestHedgeLifecycle(t *testing.T) {
+	api := newFakeHedgeAPI()
+	h := &Hedge{api: api}
+
+	args := ExecArgs{
+		Container:     "test",
+		UnikernelPath: "/unikernel",
+		Command:       "console=ttyS0",
+		TapDevice:     "tap0_urunc",
+		BlockDevice:   "/dev/dm-1",
+		MemSizeB:      512 * 1024 * 1024,
+	}
+	id, err := h.startVM(args)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, id)
+	assert.Equal(t, []hedge.VMConfig{{
+		Name:    "test",
+		Binary:  "/unikernel",
+		Mem:     512,
+		Blk:     "/dev/dm-1",
+		Net:     "tap0_urunc",
+		CmdLine: "console=ttyS0",
+	}}, api.started)
+	assert.Equal(t, "running", h.VMState("test"))
+
+	// A signal stops the VM, after which monitor returns
+	var out strings.Builder
+	sigs := make(chan os.Signal, 1)
+	sigs <- syscall.SIGTERM
+	err = h.monitor("test", id, &out, sigs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test"}, api.stopped)
+	assert.Equal(t, "unknown", h.VMState("test"))
+}
+
+func TestHedgeConsole(t *testing.T) {
+	api := newFakeHedgeAPI()
+	h := &Hedge{api: api}
+	id, err := h.startVM(ExecArgs{Container: "test", UnikernelPath: "/unikernel", Command: "console=ttyS0"})
+	assert.NoError(t, err)
+
+	// Stop the VM after the console has been read three times
+	var out strings.Builder
+	sigs := make(chan os.Signal, 1)
+	go func() {
+		for {
+			api.mu.Lock()
+			reads := api.reads[id]
+			api.mu.Unlock()
+			if reads >= 3 {
+				sigs <- syscall.SIGTERM
+				return
+			}
+			time.Sleep(exitPollInterval)
+		}
+	}()
+	err = h.monitor("test", id, &out, sigs)
+	assert.NoError(t, err)
+	// Every line of the console gets written exactly once
+	assert.Equal(t, strings.Repeat("line\n", api.reads[id]), out.String())
+	assert.GreaterOrEqual(t, api.reads[id], 3)
+}
+
+func TestHedgeShutdown(t *testing.T) {
+	api := newFakeHedgeAPI()
+	h := &Hedge{api: api}
+	_, err := h.startVM(ExecArgs{Container: "test", UnikernelPath: "/unikernel", Command: "console=ttyS0"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, h.shutdown(StopArgs{Container: "test"}))
+	assert.Equal(t, []string{"test"}, api.stopped)
+	assert.Error(t, h.shutdown(StopArgs{Container: "test"}))
+}
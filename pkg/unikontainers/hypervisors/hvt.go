@@ -15,7 +15,6 @@
 package hypervisors
 
 import (
-	"os/exec"
 	"strings"
 	"syscall"
 
@@ -118,10 +117,26 @@ func applySeccompFilter() error {
 	return nil
 }
 
-// Stop is an empty function to satisfy VMM interface compatibility requirements.
-// It does not perform any actions and always returns nil.
-func (h *HVT) Stop(_ string) error {
-	return nil
+// Stop shuts down the guest gracefully and kills the monitor, if it does
+// not exit within args.Timeout.
+func (h *HVT) Stop(args StopArgs) error {
+	return gracefulStop(args, h.shutdown)
+}
+
+// shutdown sends SIGTERM to solo5-hvt, which tears down the guest and exits.
+func (h *HVT) shutdown(args StopArgs) error {
+	return signalMonitor(args.Pid, syscall.SIGTERM)
+}
+
+// Pause freezes the cgroup of solo5-hvt, since it does not provide any
+// control channel.
+func (h *HVT) Pause(args ControlArgs) error {
+	return newCgroupFreezer().Freeze(args.Pid)
+}
+
+// Resume thaws the cgroup of solo5-hvt.
+func (h *HVT) Resume(args ControlArgs) error {
+	return newCgroupFreezer().Thaw(args.Pid)
 }
 
 // UsesKVM returns a bool value depending on if the monitor uses KVM
@@ -134,6 +149,11 @@ func (h *HVT) SupportsSharedfs() bool {
 	return false
 }
 
+// SupportsPause returns a bool value depending on the monitor support for pause
+func (h *HVT) SupportsPause() bool {
+	return true
+}
+
 // Path returns the path to the hvt binary.
 func (h *HVT) Path() string {
 	return h.binaryPath
@@ -141,7 +161,7 @@ func (h *HVT) Path() string {
 
 // Ok checks if the hvt binary is available in the system's PATH.
 func (h *HVT) Ok() error {
-	if _, err := exec.LookPath(HvtBinary); err != nil {
+	if _, err := lookupVMM(HvtVmm, HvtBinary); err != nil {
 		return ErrVMMNotInstalled
 	}
 	return nil
@@ -149,19 +169,30 @@ func (h *HVT) Ok() error {
 
 func (h *HVT) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	hvtString := string(HvtVmm)
-	hvtMem := bytesToStringMB(args.MemSizeB)
-	cmdString := h.binaryPath + " --mem=" + hvtMem
-	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorNetCli(hvtString), args.TapDevice)
-	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorBlockCli(hvtString), args.BlockDevice)
-	cmdString = appendNonEmpty(cmdString, " ", ukernel.MonitorCli(hvtString))
-	cmdString += " " + args.UnikernelPath + " " + args.Command
-	cmdArgs := strings.Split(cmdString, " ")
+	warnNoSMP(hvtString, args)
+	warnNoHugepages(hvtString, args)
+	warnNoBalloon(hvtString, args)
+	cmdArgs := buildSolo5Args(h.binaryPath, HvtVmm, args, ukernel)
 	if args.Seccomp {
 		err := applySeccompFilter()
 		if err != nil {
 			return err
 		}
 	}
-	vmmLog.WithField("hvt command", cmdString).Debug("Ready to execve hvt")
+	vmmLog.WithField("hvt command", cmdArgs).Debug("Ready to execve hvt")
 	return syscall.Exec(h.binaryPath, cmdArgs, args.Environment) //nolint: gosec
 }
+
+// buildSolo5Args creates the command line of the Solo5 tenders (hvt and
+// spt). The extra arguments get passed as they are, before the unikernel.
+func buildSolo5Args(binaryPath string, vmmType VmmType, args ExecArgs, ukernel unikernels.Unikernel) []string {
+	monitor := string(vmmType)
+	cmdString := binaryPath + " --mem=" + bytesToStringMB(args.MemSizeB)
+	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorNetCli(monitor), args.TapDevice)
+	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorBlockCli(monitor), args.BlockDevice)
+	cmdString = appendNonEmpty(cmdString, " ", ukernel.MonitorCli(monitor))
+	cmdArgs := strings.Split(cmdString, " ")
+	cmdArgs = append(cmdArgs, args.ExtraArgs...)
+	cmdArgs = append(cmdArgs, args.UnikernelPath)
+	return append(cmdArgs, strings.Split(args.Command, " ")...)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
+)
+
+const (
+	KvmtoolVmm    VmmType = "kvmtool"
+	KvmtoolBinary string  = "lkvm"
+	// The mount tag of the shared directory, which the guests expect
+	kvmtoolSharedfsTag = "fs0"
+)
+
+type Kvmtool struct {
+	binaryPath string
+	binary     string
+}
+
+// Stop shuts down the guest gracefully and kills the monitor, if it does
+// not exit within args.Timeout.
+func (k *Kvmtool) Stop(args StopArgs) error {
+	return gracefulStop(args, k.shutdown)
+}
+
+// shutdown sends SIGTERM to kvmtool, which exits after stopping the VM.
+func (k *Kvmtool) shutdown(args StopArgs) error {
+	return signalMonitor(args.Pid, syscall.SIGTERM)
+}
+
+// Pause freezes the cgroup of kvmtool. kvmtool can also pause the VM through
+// its IPC socket, but the protocol of the socket is internal to lkvm.
+func (k *Kvmtool) Pause(args ControlArgs) error {
+	return newCgroupFreezer().Freeze(args.Pid)
+}
+
+// Resume thaws the cgroup of kvmtool.
+func (k *Kvmtool) Resume(args ControlArgs) error {
+	return newCgroupFreezer().Thaw(args.Pid)
+}
+
+// Ok checks if the lkvm binary is available in the system's PATH.
+func (k *Kvmtool) Ok() error {
+	if _, err := lookupVMM(KvmtoolVmm, KvmtoolBinary); err != nil {
+		return ErrVMMNotInstalled
+	}
+	return nil
+}
+
+// UsesKVM returns a bool value depending on if the monitor uses KVM
+func (k *Kvmtool) UsesKVM() bool {
+	return true
+}
+
+// SupportsSharedfs returns a bool value depending on the monitor support for shared-fs
+func (k *Kvmtool) SupportsSharedfs() bool {
+	return true
+}
+
+// SupportsPause returns a bool value depending on the monitor support for pause
+func (k *Kvmtool) SupportsPause() bool {
+	return true
+}
+
+// Path returns the path to the lkvm binary.
+func (k *Kvmtool) Path() string {
+	return k.binaryPath
+}
+
+func (k *Kvmtool) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
+	exArgs := k.buildArgs(args, ukernel)
+	env := args.Environment
+	if args.ControlDir != "" {
+		// kvmtool creates its IPC socket under $HOME/.lkvm and it fails
+		// if it can not do so. Therefore, point HOME to a writable
+		// directory inside the monitor's rootfs.
+		env = append(env, "HOME="+args.ControlDir)
+	}
+	vmmLog.WithField("kvmtool command", exArgs).Debug("Ready to execve kvmtool")
+	return syscall.Exec(k.Path(), exArgs, env) //nolint: gosec
+}
+
+// buildArgs creates the command line of kvmtool
+func (k *Kvmtool) buildArgs(args ExecArgs, ukernel unikernels.Unikernel) []string {
+	kvmtoolString := string(KvmtoolVmm)
+	kvmtoolMem := DefaultMemory
+	if args.MemSizeB != 0 {
+		kvmtoolMem = bytesToMiB(args.MemSizeB)
+		// Check if memory is too small
+		if kvmtoolMem == 0 {
+			kvmtoolMem = DefaultMemory
+		}
+	}
+	if args.Seccomp {
+		vmmLog.Warn("kvmtool does not support seccomp filters")
+	}
+	warnNoBalloon(kvmtoolString, args)
+
+	exArgs := []string{k.Path(), "run"}
+	exArgs = append(exArgs, "--name", args.Container)
+	exArgs = append(exArgs, "--kernel", args.UnikernelPath)
+	exArgs = append(exArgs, "--params", args.Command)
+	if args.InitrdPath != "" {
+		exArgs = append(exArgs, "--initrd", args.InitrdPath)
+	}
+	exArgs = append(exArgs, "--mem", strconv.FormatUint(kvmtoolMem, 10))
+	if args.HugePageSize != 0 {
+		exArgs = append(exArgs, "--hugetlbfs", MonitorHugepagesDir)
+	}
+	exArgs = append(exArgs, "--cpus", strconv.FormatUint(uint64(vcpuCount(args)), 10))
+
+	if args.TapDevice != "" {
+		netcli := ukernel.MonitorNetCli(kvmtoolString)
+		if netcli == "" {
+			netcli = "--network mode=tap,tapif="
+		}
+		netcli += args.TapDevice
+		if args.GuestMAC != "" {
+			netcli += ",guest_mac=" + args.GuestMAC
+		}
+		exArgs = append(exArgs, strings.Fields(netcli)...)
+	} else {
+		exArgs = append(exArgs, "--network", "mode=none")
+	}
+	if args.BlockDevice != "" {
+		blockCli := ukernel.MonitorBlockCli(kvmtoolString)
+		if blockCli == "" {
+			blockCli = "--disk "
+		}
+		blockCli += args.BlockDevice
+		exArgs = append(exArgs, strings.Fields(blockCli)...)
+	}
+	if args.SharedfsPath != "" {
+		exArgs = append(exArgs, "--9p", args.SharedfsPath+","+kvmtoolSharedfsTag)
+	}
+	exArgs = append(exArgs, strings.Fields(ukernel.MonitorCli(kvmtoolString))...)
+	exArgs = append(exArgs, args.ExtraArgs...)
+
+	return exArgs
+}
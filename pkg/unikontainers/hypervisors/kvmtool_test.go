@@ -0,0 +1,88 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
+)
+
+func TestKvmtoolArgs(t *testing.T) {
+	ukernel, err := unikernels.New(unikernels.LinuxUnikernel)
+	assert.NoError(t, err)
+	k := &Kvmtool{binary: KvmtoolBinary, binaryPath: "/usr/bin/lkvm"}
+
+	tests := []struct {
+		name     string
+		args     ExecArgs
+		expected []string
+	}{
+		{
+			name: "minimal",
+			args: ExecArgs{
+				Container:     "test",
+				UnikernelPath: "/kernel",
+				Command:       "console=ttyS0 panic=-1",
+			},
+			expected: []string{"/usr/bin/lkvm", "run",
+				"--name", "test",
+				"--kernel", "/kernel",
+				"--params", "console=ttyS0 panic=-1",
+				"--mem", "256",
+				"--cpus", "1",
+				"--network", "mode=none",
+				"--console", "serial",
+			},
+		},
+		{
+			name: "all devices",
+			args: ExecArgs{
+				Container:     "test",
+				UnikernelPath: "/kernel",
+				InitrdPath:    "/initrd",
+				Command:       "console=ttyS0",
+				TapDevice:     "tap0_urunc",
+				GuestMAC:      "02:00:00:00:00:01",
+				BlockDevice:   "/dev/dm-1",
+				SharedfsPath:  "/rootfs",
+				MemSizeB:      512 * 1024 * 1024,
+				VCPUs:         2,
+				HugePageSize:  2 * 1024 * 1024,
+				ExtraArgs:     []string{"--rng"},
+			},
+			expected: []string{"/usr/bin/lkvm", "run",
+				"--name", "test",
+				"--kernel", "/kernel",
+				"--params", "console=ttyS0",
+				"--initrd", "/initrd",
+				"--mem", "512",
+				"--hugetlbfs", "/dev/hugepages",
+				"--cpus", "2",
+				"--network", "mode=tap,tapif=tap0_urunc,guest_mac=02:00:00:00:00:01",
+				"--disk", "/dev/dm-1",
+				"--9p", "/rootfs,fs0",
+				"--console", "serial",
+				"--rng",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, k.buildArgs(tc.args, ukernel))
+		})
+	}
+}
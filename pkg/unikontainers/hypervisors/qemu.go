@@ -15,9 +15,14 @@
 package hypervisors
 
 import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
 )
@@ -25,6 +30,13 @@ import (
 const (
 	QemuVmm    VmmType = "qemu"
 	QemuBinary string  = "qemu-system-"
+	// QemuDataDir is the directory of the BIOS and data files of QEMU in
+	// the rootfs of the monitor
+	QemuDataDir = "/usr/share/qemu"
+	// The QOM path of the balloon device
+	qemuBalloonPath = "/machine/peripheral/balloon0"
+	// How often the guest updates the statistics of the balloon in seconds
+	qemuBalloonStatsInterval = 2
 )
 
 type Qemu struct {
@@ -32,8 +44,161 @@ type Qemu struct {
 	binary     string
 }
 
-func (q *Qemu) Stop(_ string) error {
-	return nil
+// Stop shuts down the guest gracefully and kills the monitor, if it does
+// not exit within args.Timeout.
+func (q *Qemu) Stop(args StopArgs) error {
+	return gracefulStop(args, q.shutdown)
+}
+
+// shutdown sends an ACPI powerdown request to the guest through QMP. If
+// QMP is not available, it falls back to SIGTERM, on which QEMU exits cleanly.
+func (q *Qemu) shutdown(args StopArgs) error {
+	qmp, err := NewQMPClient(qmpSocketPath(args.BaseDir))
+	if err != nil {
+		vmmLog.WithError(err).Warn("QMP is not available, sending SIGTERM to qemu")
+		return signalMonitor(args.Pid, syscall.SIGTERM)
+	}
+	defer qmp.Close()
+	return qmp.SystemPowerdown()
+}
+
+// qmpSocketPath returns the path of the QMP socket of a container, as seen
+// by urunc.
+func qmpSocketPath(baseDir string) string {
+	return filepath.Join(baseDir, ControlDirName, QmpSocketName)
+}
+
+// Pause stops the execution of the VM through QMP. If QMP is not available,
+// it falls back to the cgroup freezer.
+func (q *Qemu) Pause(args ControlArgs) error {
+	qmp, err := NewQMPClient(qmpSocketPath(args.BaseDir))
+	if err != nil {
+		vmmLog.WithError(err).Warn("QMP is not available, freezing qemu")
+		return newCgroupFreezer().Freeze(args.Pid)
+	}
+	defer qmp.Close()
+	return qmp.Stop()
+}
+
+// Resume continues the execution of a paused VM through QMP. If QMP is not
+// available, it falls back to the cgroup freezer.
+func (q *Qemu) Resume(args ControlArgs) error {
+	qmp, err := NewQMPClient(qmpSocketPath(args.BaseDir))
+	if err != nil {
+		vmmLog.WithError(err).Warn("QMP is not available, thawing qemu")
+		return newCgroupFreezer().Thaw(args.Pid)
+	}
+	defer qmp.Close()
+	return qmp.Cont()
+}
+
+// ResizeMemory sets the memory of the guest through the balloon device.
+func (q *Qemu) ResizeMemory(args ControlArgs, sizeB uint64) error {
+	qmp, err := NewQMPClient(qmpSocketPath(args.BaseDir))
+	if err != nil {
+		return err
+	}
+	defer qmp.Close()
+	return qmp.Balloon(sizeB)
+}
+
+// BalloonStats returns the size of the guest memory and the statistics that
+// the guest reports through the balloon device. The guest starts reporting
+// its statistics after the first call, since QEMU polls them on demand.
+func (q *Qemu) BalloonStats(args ControlArgs) (*BalloonStats, error) {
+	qmp, err := NewQMPClient(qmpSocketPath(args.BaseDir))
+	if err != nil {
+		return nil, err
+	}
+	defer qmp.Close()
+
+	info, err := qmp.QueryBalloon()
+	if err != nil {
+		return nil, err
+	}
+	stats := &BalloonStats{Actual: info.Actual}
+	err = qmp.QOMSet(qemuBalloonPath, "guest-stats-polling-interval", qemuBalloonStatsInterval)
+	if err != nil {
+		return nil, err
+	}
+	var guestStats QMPGuestStats
+	err = qmp.QOMGet(qemuBalloonPath, "guest-stats", &guestStats)
+	if err != nil {
+		return nil, err
+	}
+	if guestStats.LastUpdate == 0 {
+		return stats, nil
+	}
+	stats.Guest = make(map[string]uint64)
+	for name, value := range guestStats.Stats {
+		if value >= 0 {
+			stats.Guest[name] = uint64(value)
+		}
+	}
+	return stats, nil
+}
+
+// VMStats returns the statistics that QEMU keeps for the VM and its vCPUs,
+// which QEMU reports since version 7.1 when it uses KVM. The statistics of
+// the vCPUs are summed up. Statistics that are not numbers (e.g. histograms)
+// are skipped.
+func (q *Qemu) VMStats(args ControlArgs) (map[string]uint64, error) {
+	qmp, err := NewQMPClient(qmpSocketPath(args.BaseDir))
+	if err != nil {
+		return nil, err
+	}
+	defer qmp.Close()
+
+	stats := make(map[string]uint64)
+	for _, target := range []string{"vm", "vcpu"} {
+		results, err := qmp.QueryStats(target)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			for _, stat := range result.Stats {
+				var value uint64
+				if json.Unmarshal(stat.Value, &value) != nil {
+					continue
+				}
+				stats[result.Provider+"."+target+"."+stat.Name] += value
+			}
+		}
+	}
+	return stats, nil
+}
+
+// VCPUThreads returns the IDs of the threads that run the vCPUs of the VM,
+// indexed by vCPU. Since it gets called right after the monitor starts, it
+// waits for QEMU to create the QMP socket.
+func (q *Qemu) VCPUThreads(baseDir string) ([]int, error) {
+	var qmp *QMPClient
+	var err error
+	deadline := time.Now().Add(qmpSocketTimeout)
+	for {
+		qmp, err = NewQMPClient(qmpSocketPath(baseDir))
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(exitPollInterval)
+	}
+	defer qmp.Close()
+
+	cpus, err := qmp.QueryCPUsFast()
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]int, len(cpus))
+	for _, cpu := range cpus {
+		if cpu.CPUIndex < 0 || cpu.CPUIndex >= len(cpus) {
+			return nil, fmt.Errorf("unexpected vcpu index %d", cpu.CPUIndex)
+		}
+		threads[cpu.CPUIndex] = cpu.ThreadID
+	}
+	return threads, nil
 }
 
 func (q *Qemu) Ok() error {
@@ -50,6 +215,11 @@ func (q *Qemu) SupportsSharedfs() bool {
 	return true
 }
 
+// SupportsPause returns a bool value depending on the monitor support for pause
+func (q *Qemu) SupportsPause() bool {
+	return true
+}
+
 func (q *Qemu) Path() string {
 	return q.binaryPath
 }
@@ -57,11 +227,24 @@ func (q *Qemu) Path() string {
 func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	qemuString := string(QemuVmm)
 	qemuMem := bytesToStringMB(args.MemSizeB)
+	if args.HugePageSize != 0 {
+		// The memory has to be a multiple of the hugepage size
+		qemuMem = strconv.FormatUint(bytesToMiB(args.MemSizeB), 10)
+	}
 	cmdString := q.binaryPath + " -m " + qemuMem + "M"
-	cmdString += " -L /usr/share/qemu"   // Set the path for qemu bios/data
+	if args.HugePageSize != 0 {
+		cmdString += " -mem-path " + MonitorHugepagesDir
+	}
+	cmdString += " -smp " + strconv.FormatUint(uint64(vcpuCount(args)), 10)
+	cmdString += " -L " + QemuDataDir    // Set the path for qemu bios/data
 	cmdString += " -cpu host"            // Choose CPU
 	cmdString += " -enable-kvm"          // Enable KVM to use CPU virt extensions
 	cmdString += " -nographic -vga none" // Disable graphic output
+	if args.ControlDir != "" {
+		// Create a QMP socket to control the VM
+		qmpSocket := filepath.Join(args.ControlDir, QmpSocketName)
+		cmdString += " -qmp unix:" + qmpSocket + ",server=on,wait=off"
+	}
 
 	if args.Seccomp {
 		// Enable Seccomp in QEMU
@@ -104,6 +287,10 @@ func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 		blockCli += args.BlockDevice
 		cmdString += blockCli
 	}
+	if args.Balloon {
+		cmdString += " -device virtio-balloon-pci,id=" + filepath.Base(qemuBalloonPath)
+		cmdString += ",deflate-on-oom=on,free-page-reporting=on"
+	}
 	if args.InitrdPath != "" {
 		cmdString += " -initrd " + args.InitrdPath
 	}
@@ -113,6 +300,7 @@ func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	}
 	cmdString += ukernel.MonitorCli(qemuString)
 	exArgs := strings.Split(cmdString, " ")
+	exArgs = append(exArgs, args.ExtraArgs...)
 	exArgs = append(exArgs, "-append", args.Command)
 	vmmLog.WithField("qemu command", exArgs).Debug("Ready to execve qemu")
 	return syscall.Exec(q.Path(), exArgs, args.Environment) //nolint: gosec
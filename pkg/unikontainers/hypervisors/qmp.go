@@ -0,0 +1,261 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	QmpSocketName = "qmp.sock"
+	qmpTimeout    = 5 * time.Second
+	// How long to wait for QEMU to create the QMP socket
+	qmpSocketTimeout = 10 * time.Second
+)
+
+// QMPClient is a minimal client for the QEMU Machine Protocol (QMP). It
+// executes one command at a time and ignores any asynchronous events.
+type QMPClient struct {
+	conn    net.Conn
+	decoder *json.Decoder
+}
+
+// QMPError is the error returned by QEMU for a failed command
+type QMPError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *QMPError) Error() string {
+	return fmt.Sprintf("qmp error %s: %s", e.Class, e.Desc)
+}
+
+// QMPStatus is the result of the query-status command
+type QMPStatus struct {
+	Running bool   `json:"running"`
+	Status  string `json:"status"`
+}
+
+// QMPCPUInfo is an entry in the result of the query-cpus-fast command
+type QMPCPUInfo struct {
+	CPUIndex int `json:"cpu-index"`
+	ThreadID int `json:"thread-id"`
+}
+
+// QMPBalloonInfo is the result of the query-balloon command
+type QMPBalloonInfo struct {
+	Actual uint64 `json:"actual"`
+}
+
+// QMPGuestStats is the guest-stats property of a virtio-balloon device.
+// The guest reports -1 for any statistic it does not support.
+type QMPGuestStats struct {
+	Stats      map[string]int64 `json:"stats"`
+	LastUpdate int64            `json:"last-update"`
+}
+
+// QMPStats is an entry in the result of the query-stats command, with the
+// statistics of a provider (e.g. kvm) for the VM or a vCPU
+type QMPStats struct {
+	Provider string    `json:"provider"`
+	QOMPath  string    `json:"qom-path,omitempty"`
+	Stats    []QMPStat `json:"stats"`
+}
+
+// QMPStat is a single statistic. Its value is a number, a boolean or a
+// histogram.
+type QMPStat struct {
+	Name  string          `json:"name"`
+	Value json.RawMessage `json:"value"`
+}
+
+type qmpQOMArgs struct {
+	Path     string `json:"path"`
+	Property string `json:"property"`
+	Value    any    `json:"value,omitempty"`
+}
+
+type qmpCommand struct {
+	Execute   string `json:"execute"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+type qmpResponse struct {
+	Greeting *json.RawMessage `json:"QMP,omitempty"`
+	Event    string           `json:"event,omitempty"`
+	Return   *json.RawMessage `json:"return,omitempty"`
+	Error    *QMPError        `json:"error,omitempty"`
+}
+
+// NewQMPClient connects to the QMP socket at socketPath and negotiates
+// the capabilities, so the client is ready to execute commands.
+func NewQMPClient(socketPath string) (*QMPClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), qmpTimeout)
+	defer cancel()
+	conn, err := dialUnix(ctx, socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to qmp socket %s: %w", socketPath, err)
+	}
+	c := &QMPClient{
+		conn:    conn,
+		decoder: json.NewDecoder(conn),
+	}
+
+	err = c.conn.SetDeadline(time.Now().Add(qmpTimeout))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	var greeting qmpResponse
+	err = c.decoder.Decode(&greeting)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to read qmp greeting: %w", err)
+	}
+	if greeting.Greeting == nil {
+		c.Close()
+		return nil, fmt.Errorf("unexpected qmp greeting")
+	}
+
+	err = c.Execute("qmp_capabilities", nil, nil)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection to the QMP socket
+func (c *QMPClient) Close() {
+	c.conn.Close()
+}
+
+// Execute runs a QMP command with the given arguments and, if result is
+// not nil, unmarshals the return value of the command in result.
+func (c *QMPClient) Execute(command string, args any, result any) error {
+	err := c.conn.SetDeadline(time.Now().Add(qmpTimeout))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(qmpCommand{Execute: command, Arguments: args})
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to send qmp command %s: %w", command, err)
+	}
+
+	for {
+		var resp qmpResponse
+		err = c.decoder.Decode(&resp)
+		if err != nil {
+			return fmt.Errorf("failed to read qmp response for %s: %w", command, err)
+		}
+		switch {
+		case resp.Event != "":
+			vmmLog.WithField("event", resp.Event).Debug("Received qmp event")
+		case resp.Error != nil:
+			return fmt.Errorf("%s failed: %w", command, resp.Error)
+		case resp.Return != nil:
+			if result == nil {
+				return nil
+			}
+			return json.Unmarshal(*resp.Return, result)
+		}
+	}
+}
+
+// QueryStatus returns the run state of the VM
+func (c *QMPClient) QueryStatus() (*QMPStatus, error) {
+	var status QMPStatus
+	err := c.Execute("query-status", nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// QueryCPUsFast returns the vCPUs of the VM, along with the IDs of the
+// threads that run them
+func (c *QMPClient) QueryCPUsFast() ([]QMPCPUInfo, error) {
+	var cpus []QMPCPUInfo
+	err := c.Execute("query-cpus-fast", nil, &cpus)
+	if err != nil {
+		return nil, err
+	}
+	return cpus, nil
+}
+
+// Balloon sets the memory of the guest to value bytes, by inflating or
+// deflating the balloon device
+func (c *QMPClient) Balloon(value uint64) error {
+	return c.Execute("balloon", map[string]uint64{"value": value}, nil)
+}
+
+// QueryBalloon returns the memory the guest can currently use
+func (c *QMPClient) QueryBalloon() (*QMPBalloonInfo, error) {
+	var info QMPBalloonInfo
+	err := c.Execute("query-balloon", nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// QueryStats returns the statistics for the target, which is either "vm" or
+// "vcpu"
+func (c *QMPClient) QueryStats(target string) ([]QMPStats, error) {
+	var stats []QMPStats
+	err := c.Execute("query-stats", map[string]string{"target": target}, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// QOMSet sets a property of the QOM object at path
+func (c *QMPClient) QOMSet(path string, property string, value any) error {
+	return c.Execute("qom-set", qmpQOMArgs{Path: path, Property: property, Value: value}, nil)
+}
+
+// QOMGet reads a property of the QOM object at path in result
+func (c *QMPClient) QOMGet(path string, property string, result any) error {
+	return c.Execute("qom-get", qmpQOMArgs{Path: path, Property: property}, result)
+}
+
+// Stop pauses the execution of the VM
+func (c *QMPClient) Stop() error {
+	return c.Execute("stop", nil, nil)
+}
+
+// Cont resumes the execution of a paused VM
+func (c *QMPClient) Cont() error {
+	return c.Execute("cont", nil, nil)
+}
+
+// SystemPowerdown sends an ACPI powerdown request to the guest
+func (c *QMPClient) SystemPowerdown() error {
+	return c.Execute("system_powerdown", nil, nil)
+}
+
+// Quit terminates QEMU immediately
+func (c *QMPClient) Quit() error {
+	return c.Execute("quit", nil, nil)
+}
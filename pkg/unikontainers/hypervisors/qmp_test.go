@@ -0,0 +1,271 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQMPServer emulates the QMP server of QEMU, answering to a handful of
+// commands and recording every command it receives.
+type fakeQMPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	commands []string
+	status   string
+}
+
+func newFakeQMPServer(t *testing.T, socketPath string) *fakeQMPServer {
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socketPath, err)
+	}
+	s := &fakeQMPServer{listener: listener, status: "running"}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeQMPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeQMPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+	_ = encoder.Encode(map[string]any{
+		"QMP": map[string]any{"version": map[string]any{}, "capabilities": []string{}},
+	})
+	for {
+		var cmd qmpCommand
+		if decoder.Decode(&cmd) != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd.Execute)
+		var resp any = map[string]any{"return": map[string]any{}}
+		switch cmd.Execute {
+		case "query-status":
+			resp = map[string]any{"return": QMPStatus{Running: s.status == "running", Status: s.status}}
+		case "stop":
+			s.status = "paused"
+			// QEMU emits an event before the response
+			_ = encoder.Encode(map[string]any{"event": "STOP"})
+		case "cont":
+			s.status = "running"
+		case "query-cpus-fast":
+			// QEMU does not guarantee the order of the vCPUs
+			resp = map[string]any{"return": []QMPCPUInfo{
+				{CPUIndex: 1, ThreadID: 1002},
+				{CPUIndex: 0, ThreadID: 1001},
+			}}
+		case "query-balloon":
+			resp = map[string]any{"return": QMPBalloonInfo{Actual: 256 * 1024 * 1024}}
+		case "qom-get":
+			resp = map[string]any{"return": QMPGuestStats{
+				Stats:      map[string]int64{"stat-free-memory": 128 * 1024 * 1024, "stat-htlb-pgalloc": -1},
+				LastUpdate: 1700000000,
+			}}
+		case "query-stats":
+			resp = map[string]any{"return": fakeQMPStats(cmd.Arguments)}
+		case "qmp_capabilities", "system_powerdown", "quit", "balloon", "qom-set":
+		default:
+			resp = map[string]any{"error": QMPError{Class: "CommandNotFound", Desc: "unknown command"}}
+		}
+		s.mu.Unlock()
+		_ = encoder.Encode(resp)
+	}
+}
+
+// fakeQMPStats returns the statistics of a VM with two vCPUs
+func fakeQMPStats(arguments any) []map[string]any {
+	args, _ := arguments.(map[string]any)
+	if args["target"] == "vm" {
+		return []map[string]any{{
+			"provider": "kvm",
+			"stats": []map[string]any{
+				{"name": "pages-4k", "value": 1024},
+				{"name": "max-mmu-page-hash-collisions", "value": 0},
+			},
+		}}
+	}
+	vcpu := func(path string, exits int) map[string]any {
+		return map[string]any{
+			"provider": "kvm",
+			"qom-path": path,
+			"stats": []map[string]any{
+				{"name": "exits", "value": exits},
+				{"name": "guest-mode", "value": false},
+				{"name": "halt-poll-fail-hist", "value": []int{1, 2}},
+			},
+		}
+	}
+	return []map[string]any{
+		vcpu("/machine/unattached/device[0]", 100),
+		vcpu("/machine/unattached/device[1]", 50),
+	}
+}
+
+func (s *fakeQMPServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+func TestQMPClient(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), QmpSocketName)
+	server := newFakeQMPServer(t, socketPath)
+
+	qmp, err := NewQMPClient(socketPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer qmp.Close()
+
+	status, err := qmp.QueryStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, &QMPStatus{Running: true, Status: "running"}, status)
+
+	assert.NoError(t, qmp.Stop())
+	status, err = qmp.QueryStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, "paused", status.Status)
+	assert.False(t, status.Running)
+
+	assert.NoError(t, qmp.Cont())
+	assert.NoError(t, qmp.SystemPowerdown())
+	assert.NoError(t, qmp.Quit())
+
+	err = qmp.Execute("unknown", nil, nil)
+	var qmpErr *QMPError
+	if assert.ErrorAs(t, err, &qmpErr) {
+		assert.Equal(t, "CommandNotFound", qmpErr.Class)
+	}
+
+	expected := []string{"qmp_capabilities", "query-status", "stop", "query-status",
+		"cont", "system_powerdown", "quit", "unknown"}
+	assert.Equal(t, expected, server.received())
+}
+
+func TestQemuShutdown(t *testing.T) {
+	baseDir := t.TempDir()
+	socketPath := qmpSocketPath(baseDir)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0o700))
+	server := newFakeQMPServer(t, socketPath)
+
+	q := &Qemu{}
+	assert.NoError(t, q.shutdown(StopArgs{Container: "test", BaseDir: baseDir}))
+	assert.Equal(t, []string{"qmp_capabilities", "system_powerdown"}, server.received())
+}
+
+func TestQMPClientNoSocket(t *testing.T) {
+	_, err := NewQMPClient(filepath.Join(t.TempDir(), QmpSocketName))
+	assert.Error(t, err)
+}
+
+func TestQemuPauseResume(t *testing.T) {
+	baseDir := t.TempDir()
+	socketPath := qmpSocketPath(baseDir)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0o700))
+	server := newFakeQMPServer(t, socketPath)
+
+	q := &Qemu{}
+	args := ControlArgs{Container: "test", BaseDir: baseDir}
+	assert.NoError(t, q.Pause(args))
+	assert.NoError(t, q.Resume(args))
+	expected := []string{"qmp_capabilities", "stop", "qmp_capabilities", "cont"}
+	assert.Equal(t, expected, server.received())
+}
+
+func TestQemuVCPUThreads(t *testing.T) {
+	baseDir := t.TempDir()
+	socketPath := qmpSocketPath(baseDir)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0o700))
+
+	// QEMU creates the socket after urunc starts waiting for it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(100 * time.Millisecond)
+		newFakeQMPServer(t, socketPath)
+	}()
+	q := &Qemu{}
+	threads, err := q.VCPUThreads(baseDir)
+	<-done
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1001, 1002}, threads)
+}
+
+func TestQemuResizeMemory(t *testing.T) {
+	baseDir := t.TempDir()
+	socketPath := qmpSocketPath(baseDir)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0o700))
+	server := newFakeQMPServer(t, socketPath)
+
+	q := &Qemu{}
+	args := ControlArgs{Container: "test", BaseDir: baseDir, MemSizeB: 512 * 1024 * 1024}
+	assert.NoError(t, q.ResizeMemory(args, 256*1024*1024))
+	assert.Equal(t, []string{"qmp_capabilities", "balloon"}, server.received())
+}
+
+func TestQemuBalloonStats(t *testing.T) {
+	baseDir := t.TempDir()
+	socketPath := qmpSocketPath(baseDir)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0o700))
+	server := newFakeQMPServer(t, socketPath)
+
+	q := &Qemu{}
+	stats, err := q.BalloonStats(ControlArgs{Container: "test", BaseDir: baseDir})
+	assert.NoError(t, err)
+	// The statistics that the guest does not support get dropped
+	assert.Equal(t, &BalloonStats{
+		Actual: 256 * 1024 * 1024,
+		Guest:  map[string]uint64{"stat-free-memory": 128 * 1024 * 1024},
+	}, stats)
+	assert.Equal(t, []string{"qmp_capabilities", "query-balloon", "qom-set", "qom-get"}, server.received())
+}
+
+func TestQemuVMStats(t *testing.T) {
+	baseDir := t.TempDir()
+	socketPath := qmpSocketPath(baseDir)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0o700))
+	server := newFakeQMPServer(t, socketPath)
+
+	q := &Qemu{}
+	stats, err := q.VMStats(ControlArgs{Container: "test", BaseDir: baseDir})
+	assert.NoError(t, err)
+	// The vCPUs get summed up and anything but numbers gets dropped
+	assert.Equal(t, map[string]uint64{
+		"kvm.vm.pages-4k":                     1024,
+		"kvm.vm.max-mmu-page-hash-collisions": 0,
+		"kvm.vcpu.exits":                      150,
+	}, stats)
+	assert.Equal(t, []string{"qmp_capabilities", "query-stats", "query-stats"}, server.received())
+}
@@ -15,8 +15,6 @@
 package hypervisors
 
 import (
-	"os/exec"
-	"strings"
 	"syscall"
 
 	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
@@ -32,10 +30,26 @@ type SPT struct {
 	binary     string
 }
 
-// Stop is an empty function to satisfy VMM interface compatibility requirements.
-// It does not perform any actions and always returns nil.
-func (s *SPT) Stop(_ string) error {
-	return nil
+// Stop shuts down the guest gracefully and kills the monitor, if it does
+// not exit within args.Timeout.
+func (s *SPT) Stop(args StopArgs) error {
+	return gracefulStop(args, s.shutdown)
+}
+
+// shutdown sends SIGTERM to solo5-spt, which tears down the guest and exits.
+func (s *SPT) shutdown(args StopArgs) error {
+	return signalMonitor(args.Pid, syscall.SIGTERM)
+}
+
+// Pause freezes the cgroup of solo5-spt, since it does not provide any
+// control channel.
+func (s *SPT) Pause(args ControlArgs) error {
+	return newCgroupFreezer().Freeze(args.Pid)
+}
+
+// Resume thaws the cgroup of solo5-spt.
+func (s *SPT) Resume(args ControlArgs) error {
+	return newCgroupFreezer().Thaw(args.Pid)
 }
 
 // UsesKVM returns a bool value depending on if the monitor uses KVM
@@ -48,6 +62,11 @@ func (s *SPT) SupportsSharedfs() bool {
 	return false
 }
 
+// SupportsPause returns a bool value depending on the monitor support for pause
+func (s *SPT) SupportsPause() bool {
+	return true
+}
+
 // Path returns the path to the spt binary.
 func (s *SPT) Path() string {
 	return s.binaryPath
@@ -55,7 +74,7 @@ func (s *SPT) Path() string {
 
 // Ok checks if the spt binary is available in the system's PATH.
 func (s *SPT) Ok() error {
-	if _, err := exec.LookPath(SptBinary); err != nil {
+	if _, err := lookupVMM(SptVmm, SptBinary); err != nil {
 		return ErrVMMNotInstalled
 	}
 	return nil
@@ -63,13 +82,10 @@ func (s *SPT) Ok() error {
 
 func (s *SPT) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	sptString := string(SptVmm)
-	sptMem := bytesToStringMB(args.MemSizeB)
-	cmdString := s.binaryPath + " --mem=" + sptMem
-	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorNetCli(sptString), args.TapDevice)
-	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorBlockCli(sptString), args.BlockDevice)
-	cmdString = appendNonEmpty(cmdString, " ", ukernel.MonitorCli(sptString))
-	cmdString += " " + args.UnikernelPath + " " + args.Command
-	cmdArgs := strings.Split(cmdString, " ")
-	vmmLog.WithField("spt command", cmdString).Debug("Ready to execve spt")
+	warnNoSMP(sptString, args)
+	warnNoHugepages(sptString, args)
+	warnNoBalloon(sptString, args)
+	cmdArgs := buildSolo5Args(s.binaryPath, SptVmm, args, ukernel)
+	vmmLog.WithField("spt command", cmdArgs).Debug("Ready to execve spt")
 	return syscall.Exec(s.binaryPath, cmdArgs, args.Environment) //nolint: gosec
 }
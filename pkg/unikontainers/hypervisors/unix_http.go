@@ -0,0 +1,98 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// unixHTTPClient is a minimal client for the JSON HTTP APIs that VMMs
+// (e.g. Firecracker, Cloud Hypervisor) serve over a unix socket.
+type unixHTTPClient struct {
+	client *http.Client
+}
+
+// apiFault is the error format of the Firecracker API
+type apiFault struct {
+	FaultMessage string `json:"fault_message"`
+}
+
+func newUnixHTTPClient(socketPath string, timeout time.Duration) *unixHTTPClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialUnix(ctx, socketPath)
+		},
+	}
+	return &unixHTTPClient{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
+// request sends a request with body encoded as JSON, if it is not nil.
+// It returns an error if the response status is not 2xx.
+func (c *unixHTTPClient) request(method string, path string, body any) error {
+	_, err := c.do(method, path, body)
+	return err
+}
+
+// do is like request, but it also returns the body of the response
+func (c *unixHTTPClient) do(method string, path string, body any) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://localhost"+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response of API %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return respBody, nil
+	}
+
+	var fault apiFault
+	if json.Unmarshal(respBody, &fault) != nil || fault.FaultMessage == "" {
+		fault.FaultMessage = strings.TrimSpace(string(respBody))
+	}
+	return nil, fmt.Errorf("API %s %s failed with %d: %s", method, path, resp.StatusCode, fault.FaultMessage)
+}
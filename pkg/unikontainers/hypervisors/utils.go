@@ -15,8 +15,19 @@
 package hypervisors
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func cpuArch() string {
@@ -37,6 +48,47 @@ func appendNonEmpty(body, prefix, value string) string {
 	return body
 }
 
+// vcpuCount returns the number of vCPUs requested in args or the default
+func vcpuCount(args ExecArgs) uint {
+	if args.VCPUs == 0 {
+		return DefaultVCPUs
+	}
+	return args.VCPUs
+}
+
+// warnNoSMP warns that a monitor without SMP support will use a single vCPU
+func warnNoSMP(monitor string, args ExecArgs) {
+	if vcpuCount(args) > 1 {
+		vmmLog.WithField("vcpus", args.VCPUs).Warnf("%s does not support multiple vCPUs, the VM will use one vCPU", monitor)
+	}
+}
+
+// hugePageSizeString returns the size of a hugepage in the format that
+// most monitors expect (e.g. 2M, 1G)
+func hugePageSizeString(size uint64) string {
+	const bytesInGiB = 1024 * 1024 * 1024
+	if size%bytesInGiB == 0 {
+		return strconv.FormatUint(size/bytesInGiB, 10) + "G"
+	}
+	return strconv.FormatUint(bytesToMiB(size), 10) + "M"
+}
+
+// warnNoHugepages warns that a monitor without hugepage support will use
+// regular pages for the guest memory
+func warnNoHugepages(monitor string, args ExecArgs) {
+	if args.HugePageSize != 0 {
+		vmmLog.Warnf("%s does not support hugepages, the guest memory will use regular pages", monitor)
+	}
+}
+
+// warnNoBalloon warns that a monitor without a balloon device will not
+// create one
+func warnNoBalloon(monitor string, args ExecArgs) {
+	if args.Balloon {
+		vmmLog.Warnf("%s does not support a balloon device", monitor)
+	}
+}
+
 func bytesToMiB(bytes uint64) uint64 {
 	const bytesInMiB = 1024 * 1024
 	return bytes / bytesInMiB
@@ -60,3 +112,121 @@ func bytesToStringMB(argMem uint64) string {
 
 	return stringMem
 }
+
+// signalMonitor sends a signal to the monitor process. It is not an error
+// if the monitor has already exited.
+func signalMonitor(pid int, sig syscall.Signal) error {
+	err := syscall.Kill(pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// ProcessExited checks if the process with the given pid has exited. If
+// the process has exited, but it has not been reaped yet by its parent,
+// its wait status is also returned, as found in /proc/<pid>/stat.
+func ProcessExited(pid int) (bool, *unix.WaitStatus) {
+	if pid <= 0 {
+		return true, nil
+	}
+	err := unix.Kill(pid, unix.Signal(0))
+	if errors.Is(err, unix.ESRCH) {
+		return true, nil
+	}
+
+	state, ws, err := readProcStat(pid)
+	if err != nil {
+		// The process might have just been reaped
+		if errors.Is(err, os.ErrNotExist) {
+			return true, nil
+		}
+		// We can not tell, so consider it still alive
+		return false, nil
+	}
+	if state == "Z" || state == "X" {
+		return true, ws
+	}
+	return false, nil
+}
+
+// ProcStatFields returns the fields of the stat file in the procfs directory
+// of a process (e.g. /proc/<pid>), starting from the state, the 3rd field.
+func ProcStatFields(procDir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The second field is the executable's name in parentheses and it can
+	// contain spaces. Hence, skip it by searching for the last ')'.
+	stat := string(data)
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid format of %s/stat", procDir)
+	}
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid format of %s/stat", procDir)
+	}
+	return fields, nil
+}
+
+// readProcStat returns the state and the exit status (in the form reported by
+// waitpid) of a process, as found in /proc/<pid>/stat. The exit status is nil
+// if it is not available.
+func readProcStat(pid int) (string, *unix.WaitStatus, error) {
+	fields, err := ProcStatFields(filepath.Join("/proc", strconv.Itoa(pid)))
+	if err != nil {
+		return "", nil, err
+	}
+	state := fields[0]
+
+	// exit_code is the 52nd field and it is available since Linux 3.5
+	const exitCodeField = 52 - 3
+	if len(fields) <= exitCodeField {
+		return state, nil, nil
+	}
+	exitCode, err := strconv.ParseUint(fields[exitCodeField], 10, 32)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid exit code in /proc/%d/stat: %w", pid, err)
+	}
+	ws := unix.WaitStatus(exitCode)
+	return state, &ws, nil
+}
+
+// waitForExit polls the monitor process until it exits or the timeout
+// expires. It returns true if the monitor exited.
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		exited, _ := ProcessExited(pid)
+		if exited {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(exitPollInterval)
+	}
+}
+
+// maxUnixPathLen is the maximum length of a unix socket path (sun_path)
+const maxUnixPathLen = 107
+
+// dialUnix connects to a unix socket. The paths under the state directory
+// of a container can exceed the length limit of unix socket paths. In that
+// case, the socket is accessed through a file descriptor of its directory.
+func dialUnix(ctx context.Context, socketPath string) (net.Conn, error) {
+	var d net.Dialer
+	if len(socketPath) <= maxUnixPathLen {
+		return d.DialContext(ctx, "unix", socketPath)
+	}
+	dirFd, err := unix.Open(filepath.Dir(socketPath), unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the directory of %s: %w", socketPath, err)
+	}
+	defer unix.Close(dirFd)
+	shortPath := fmt.Sprintf("/proc/self/fd/%d/%s", dirFd, filepath.Base(socketPath))
+	return d.DialContext(ctx, "unix", shortPath)
+}
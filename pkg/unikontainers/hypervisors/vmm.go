@@ -17,13 +17,32 @@ package hypervisors
 import (
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/urunc-dev/urunc/internal/config"
 	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
 )
 
-const DefaultMemory uint64 = 256 // The default memory for every hypervisor: 256 MB
+const (
+	DefaultMemory      uint64 = 256 // The default memory for every hypervisor: 256 MB
+	DefaultVCPUs       uint   = 1   // The default number of vCPUs for every hypervisor
+	DefaultStopTimeout        = 10 * time.Second
+	// KillTimeout is how long to wait for the monitor to exit after a SIGKILL
+	KillTimeout      = 2 * time.Second
+	exitPollInterval = 10 * time.Millisecond
+	// ControlDirName is the directory under the container's base directory,
+	// where the VMMs create their control sockets. It is mounted inside the
+	// monitor's rootfs at MonitorControlDir.
+	ControlDirName    = "vmm"
+	MonitorControlDir = "/tmp/urunc"
+	// MonitorHugepagesDir is the mount point of hugetlbfs inside the
+	// monitor's rootfs, for the VMMs that back the guest memory with files.
+	MonitorHugepagesDir = "/dev/hugepages"
+)
 
 // ExecArgs holds the data required by Execve to start the VMM
 // FIXME: add extra fields if required by additional VMM's
@@ -39,7 +58,72 @@ type ExecArgs struct {
 	GuestMAC      string   // The MAC address of the guest network device
 	Seccomp       bool     // Enable or disable seccomp filters for the VMM
 	MemSizeB      uint64   // The size of the memory provided to the VM in bytes
+	VCPUs         uint     // The number of vCPUs of the VM
+	HugePageSize  uint64   // The size of the hugepages backing the guest memory in bytes, 0 for regular pages
 	Environment   []string // Environment
+	ControlDir    string   // The directory for the control sockets of the VMM
+	WithAPI       bool     // Configure the VM through the API socket of the VMM
+	Balloon       bool     // Add a balloon device to the VM
+	VMMetrics     bool     // Export the metrics of the VMM in the control directory
+	ExtraArgs     []string // Extra arguments for the VMM from the urunc configuration
+}
+
+// StopArgs holds the data required by the VMM to shut down a running VM
+type StopArgs struct {
+	Container string        // The container ID
+	Pid       int           // The PID of the monitor process
+	BaseDir   string        // The directory where urunc stores the container's state
+	Timeout   time.Duration // How long to wait for the guest to shut down, zero to not wait at all
+}
+
+// ControlArgs holds the data required by the VMM to control a running VM
+// (e.g. pause it)
+type ControlArgs struct {
+	Container string // The container ID
+	Pid       int    // The PID of the monitor process
+	BaseDir   string // The directory where urunc stores the container's state
+	MemSizeB  uint64 // The memory the VM booted with in bytes, 0 for the default
+}
+
+// An APIConfigurator is a VMM which, in API mode, gets configured after the
+// monitor process has started. ConfigureVM also boots the VM.
+type APIConfigurator interface {
+	ConfigureVM(baseDir string) error
+}
+
+// A VCPUThreader is a VMM which runs each vCPU of the VM in a separate
+// thread of the monitor and it can report the IDs of these threads.
+type VCPUThreader interface {
+	VCPUThreads(baseDir string) ([]int, error)
+}
+
+// A MemoryResizer is a VMM which can change the memory available to a
+// running guest through a balloon device. The guest can never get more
+// memory than it booted with.
+type MemoryResizer interface {
+	ResizeMemory(args ControlArgs, sizeB uint64) error
+}
+
+// A BalloonReporter is a VMM which can report the statistics of the
+// balloon device of a running VM.
+type BalloonReporter interface {
+	BalloonStats(args ControlArgs) (*BalloonStats, error)
+}
+
+// BalloonStats are the statistics of the balloon device of a VM
+type BalloonStats struct {
+	// The memory the guest can use, excluding the balloon, in bytes
+	Actual uint64 `json:"actual"`
+	// The statistics the guest reports (e.g. its free memory), if the
+	// VMM supports them. The names and the units depend on the VMM.
+	Guest map[string]uint64 `json:"guest,omitempty"`
+}
+
+// A StatsReporter is a VMM which can report the statistics it keeps for a
+// running VM (e.g. the exits of the vCPUs). The names of the statistics
+// depend on the VMM.
+type StatsReporter interface {
+	VMStats(args ControlArgs) (map[string]uint64, error)
 }
 
 type VmmType string
@@ -47,12 +131,33 @@ type VmmType string
 var ErrVMMNotInstalled = errors.New("vmm not found")
 var vmmLog = logrus.WithField("subsystem", "hypervisors")
 
+// The maximum number of vCPUs of the VMMs which have one, besides the
+// limit of KVM
+var maxVCPUs = map[VmmType]uint{
+	FirecrackerVmm:     32,
+	CloudHypervisorVmm: 254,
+}
+
+// MaxVCPUs returns the maximum number of vCPUs of a VM of the given VMM,
+// or 0 if the VMM has no limit of its own
+func MaxVCPUs(vmmType VmmType) uint {
+	return maxVCPUs[vmmType]
+}
+
 type VMM interface {
 	Execve(args ExecArgs, ukernel unikernels.Unikernel) error
-	Stop(t string) error
+	// Stop asks the guest to shut down and waits for the monitor to exit.
+	// If the monitor is still alive after args.Timeout, it gets killed.
+	// With a zero args.Timeout, Stop returns without waiting for the guest.
+	Stop(args StopArgs) error
+	// Pause and Resume pause and resume the execution of the guest. They
+	// should be called only if SupportsPause returns true.
+	Pause(args ControlArgs) error
+	Resume(args ControlArgs) error
 	Path() string
 	UsesKVM() bool
 	SupportsSharedfs() bool
+	SupportsPause() bool
 	Ok() error
 }
 
@@ -64,37 +169,90 @@ func NewVMM(vmmType VmmType) (vmm VMM, err error) {
 	}()
 	switch vmmType {
 	case SptVmm:
-		vmmPath, err := exec.LookPath(SptBinary)
+		vmmPath, err := lookupVMM(SptVmm, SptBinary)
 		if err != nil {
 			return nil, ErrVMMNotInstalled
 		}
 		return &SPT{binary: SptBinary, binaryPath: vmmPath}, nil
 	case HvtVmm:
-		vmmPath, err := exec.LookPath(HvtBinary)
+		vmmPath, err := lookupVMM(HvtVmm, HvtBinary)
 		if err != nil {
 			return nil, ErrVMMNotInstalled
 		}
 		return &HVT{binary: HvtBinary, binaryPath: vmmPath}, nil
 	case QemuVmm:
-		vmmPath, err := exec.LookPath(QemuBinary + cpuArch())
+		vmmPath, err := lookupVMM(QemuVmm, QemuBinary+cpuArch())
 		if err != nil {
 			return nil, ErrVMMNotInstalled
 		}
 		return &Qemu{binary: QemuBinary, binaryPath: vmmPath}, nil
 	case FirecrackerVmm:
-		vmmPath, err := exec.LookPath(FirecrackerBinary)
+		vmmPath, err := lookupVMM(FirecrackerVmm, FirecrackerBinary)
 		if err != nil {
 			return nil, ErrVMMNotInstalled
 		}
 		return &Firecracker{binary: FirecrackerBinary, binaryPath: vmmPath}, nil
+	case CloudHypervisorVmm:
+		vmmPath, err := lookupVMM(CloudHypervisorVmm, CloudHypervisorBinary)
+		if err != nil {
+			return nil, ErrVMMNotInstalled
+		}
+		return &CloudHypervisor{binary: CloudHypervisorBinary, binaryPath: vmmPath}, nil
+	case KvmtoolVmm:
+		vmmPath, err := lookupVMM(KvmtoolVmm, KvmtoolBinary)
+		if err != nil {
+			return nil, ErrVMMNotInstalled
+		}
+		return &Kvmtool{binary: KvmtoolBinary, binaryPath: vmmPath}, nil
 	case HedgeVmm:
-		hedge := Hedge{}
+		hedge := &Hedge{api: hedgeCLI{}}
 		err := hedge.Ok()
 		if err != nil {
 			return nil, ErrVMMNotInstalled
 		}
-		return &hedge, nil
+		return hedge, nil
 	default:
 		return nil, fmt.Errorf("vmm \"%s\" is not supported", vmmType)
 	}
 }
+
+// lookupVMM returns the path of the binary of the VMM, which is either set
+// in the urunc configuration or found in PATH.
+func lookupVMM(vmmType VmmType, binary string) (string, error) {
+	path := config.Get().Hypervisor(string(vmmType)).Path
+	if path == "" {
+		return exec.LookPath(binary)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() || info.Mode()&0o111 == 0 {
+		return "", fmt.Errorf("%s is not executable", path)
+	}
+	return path, nil
+}
+
+// gracefulStop implements the Stop contract on top of shutdown, which asks
+// the guest to shut down without waiting for it.
+func gracefulStop(args StopArgs, shutdown func(StopArgs) error) error {
+	if args.Timeout <= 0 {
+		return shutdown(args)
+	}
+	err := shutdown(args)
+	if err != nil {
+		vmmLog.WithError(err).Warn("failed to shut down the guest gracefully")
+	} else if waitForExit(args.Pid, args.Timeout) {
+		return nil
+	}
+
+	vmmLog.WithField("pid", args.Pid).Warn("killing the monitor process")
+	err = signalMonitor(args.Pid, syscall.SIGKILL)
+	if err != nil {
+		return fmt.Errorf("failed to kill the monitor: %w", err)
+	}
+	if !waitForExit(args.Pid, KillTimeout) {
+		return fmt.Errorf("monitor process %d did not exit after SIGKILL", args.Pid)
+	}
+	return nil
+}
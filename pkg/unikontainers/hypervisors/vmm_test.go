@@ -0,0 +1,150 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urunc-dev/urunc/internal/config"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/unikernels"
+)
+
+func TestGracefulStop(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		signal int
+	}{
+		{"exits on SIGTERM", "exec sleep 10", 15},
+		{"ignores SIGTERM", "trap '' TERM; exec sleep 10", 9},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", tc.script)
+			assert.NoError(t, cmd.Start())
+			// Give sh the time to set up the trap
+			time.Sleep(100 * time.Millisecond)
+
+			spt := &SPT{}
+			err := spt.Stop(StopArgs{
+				Container: "test",
+				Pid:       cmd.Process.Pid,
+				Timeout:   200 * time.Millisecond,
+			})
+			assert.NoError(t, err)
+
+			exited, ws := ProcessExited(cmd.Process.Pid)
+			assert.True(t, exited)
+			if assert.NotNil(t, ws) {
+				assert.True(t, ws.Signaled())
+				assert.Equal(t, tc.signal, int(ws.Signal()))
+			}
+			_ = cmd.Wait()
+		})
+	}
+}
+
+func TestStopWithoutTimeout(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "trap '' TERM; exec sleep 10")
+	assert.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	// Give sh the time to set up the trap
+	time.Sleep(100 * time.Millisecond)
+
+	// Without a timeout, Stop only asks the guest to shut down and never
+	// escalates to SIGKILL
+	spt := &SPT{}
+	err := spt.Stop(StopArgs{Container: "test", Pid: cmd.Process.Pid})
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	exited, _ := ProcessExited(cmd.Process.Pid)
+	assert.False(t, exited)
+}
+
+func TestLookupVMM(t *testing.T) {
+	defer config.Set(config.Get())
+
+	// Every VMM can have a section in the urunc configuration
+	for _, vmmType := range []VmmType{SptVmm, HvtVmm, QemuVmm, FirecrackerVmm, CloudHypervisorVmm, KvmtoolVmm, HedgeVmm} {
+		c := config.Default()
+		c.Hypervisors[string(vmmType)] = config.Hypervisor{}
+		assert.NoError(t, c.Validate(), vmmType)
+	}
+
+	c := config.Default()
+	c.Hypervisors[string(QemuVmm)] = config.Hypervisor{Path: "/bin/sh"}
+	config.Set(c)
+	path, err := lookupVMM(QemuVmm, QemuBinary+cpuArch())
+	assert.NoError(t, err)
+	assert.Equal(t, "/bin/sh", path)
+	vmm, err := NewVMM(QemuVmm)
+	assert.NoError(t, err)
+	assert.Equal(t, "/bin/sh", vmm.Path())
+
+	c.Hypervisors[string(QemuVmm)] = config.Hypervisor{Path: filepath.Join(t.TempDir(), "qemu")}
+	_, err = lookupVMM(QemuVmm, QemuBinary+cpuArch())
+	assert.Error(t, err)
+	c.Hypervisors[string(QemuVmm)] = config.Hypervisor{Path: t.TempDir()}
+	_, err = lookupVMM(QemuVmm, QemuBinary+cpuArch())
+	assert.Error(t, err)
+}
+
+func TestOk(t *testing.T) {
+	defer config.Set(config.Get())
+
+	tests := []struct {
+		vmmType VmmType
+		vmm     VMM
+	}{
+		{CloudHypervisorVmm, &CloudHypervisor{}},
+		{KvmtoolVmm, &Kvmtool{}},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.vmmType), func(t *testing.T) {
+			c := config.Default()
+			config.Set(c)
+			c.Hypervisors[string(tc.vmmType)] = config.Hypervisor{Path: "/bin/sh"}
+			assert.NoError(t, tc.vmm.Ok())
+			c.Hypervisors[string(tc.vmmType)] = config.Hypervisor{Path: filepath.Join(t.TempDir(), "vmm")}
+			assert.ErrorIs(t, tc.vmm.Ok(), ErrVMMNotInstalled)
+		})
+	}
+}
+
+func TestSolo5Args(t *testing.T) {
+	ukernel, err := unikernels.New(unikernels.RumprunUnikernel)
+	assert.NoError(t, err)
+	args := ExecArgs{
+		UnikernelPath: "/unikernel",
+		Command:       `{"cmdline":"redis"}`,
+		TapDevice:     "tap0_urunc",
+		BlockDevice:   "/dev/dm-1",
+		MemSizeB:      512 * 1000 * 1000,
+		ExtraArgs:     []string{"--dumpcore=/tmp/core dir", "-x"},
+	}
+	assert.Equal(t, []string{"/usr/bin/solo5-hvt", "--mem=512",
+		"--net:tap=tap0_urunc", "--block:rootfs=/dev/dm-1",
+		"--dumpcore=/tmp/core dir", "-x",
+		"/unikernel", `{"cmdline":"redis"}`,
+	}, buildSolo5Args("/usr/bin/solo5-hvt", HvtVmm, args, ukernel))
+}
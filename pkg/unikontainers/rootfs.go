@@ -20,13 +20,17 @@
 package unikontainers
 
 import (
+	"debug/elf"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urunc-dev/urunc/internal/config"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/hypervisors"
 )
 
 type mountFlagStruct struct {
@@ -113,15 +117,26 @@ func changeRoot(rootfsDir string, pivot bool) error {
 // prepareMonRootfs prepares the rootfs where the monitor will execute. It
 // essentially sets up the devices (KVM, snapshotter block device) that are required
 // for the guest execution and any other files (e.g. binaries).
-func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needsKVM bool, needsTAP bool) error {
-	err := fileFromHost(monRootfs, monitorPath, "", unix.MS_BIND|unix.MS_PRIVATE, false)
-	if err != nil {
-		return err
+func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needsKVM bool, needsTAP bool, hugePageSize uint64) error {
+	var err error
+	// Some VMMs (e.g. Hedge) do not have a monitor binary
+	dynamic := false
+	monitorName := filepath.Base(monitorPath)
+	if monitorPath != "" {
+		err = fileFromHost(monRootfs, monitorPath, "", unix.MS_BIND|unix.MS_PRIVATE, false)
+		if err != nil {
+			return err
+		}
+		dynamic, err = isDynamicallyLinked(monitorPath)
+		if err != nil {
+			uniklog.WithError(err).Warnf("could not check if %s is statically linked", monitorName)
+			dynamic = true
+		}
 	}
 
+	// Dynamically linked monitors need the shared libraries of the host.
 	// TODO: Remove these when we switch to static binaries
-	monitorName := filepath.Base(monitorPath)
-	if monitorName != "firecracker" {
+	if dynamic {
 		err = fileFromHost(monRootfs, "/lib", "", unix.MS_BIND|unix.MS_PRIVATE, false)
 		if err != nil {
 			return err
@@ -143,12 +158,15 @@ func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needs
 
 	// TODO: Remove these when we switch to static binaries
 	if len(monitorName) >= 4 && monitorName[:4] == "qemu" {
-		qDataPath, err := findQemuDataDir("qemu")
-		if err != nil {
-			return err
+		qDataPath := config.Get().Hypervisor(string(hypervisors.QemuVmm)).DataPath
+		if qDataPath == "" {
+			qDataPath, err = findQemuDataDir("qemu")
+			if err != nil {
+				return err
+			}
 		}
 
-		err = fileFromHost(monRootfs, qDataPath, "/usr/share/qemu", unix.MS_BIND|unix.MS_PRIVATE, false)
+		err = fileFromHost(monRootfs, qDataPath, hypervisors.QemuDataDir, unix.MS_BIND|unix.MS_PRIVATE, false)
 		if err != nil {
 			return err
 		}
@@ -219,9 +237,68 @@ func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needs
 		}
 	}
 
+	if hugePageSize != 0 {
+		err = mountHugetlbfs(monRootfs, hugePageSize)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// mountHugetlbfs mounts a hugetlbfs with the given page size inside the
+// monitor's rootfs, for the monitors which back the guest memory with files.
+// The monitor might not run as root and hence everyone can create files in it.
+func mountHugetlbfs(monRootfs string, pageSize uint64) error {
+	dstPath := filepath.Join(monRootfs, hypervisors.MonitorHugepagesDir)
+	err := os.MkdirAll(dstPath, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s dir: %w", hypervisors.MonitorHugepagesDir, err)
+	}
+	data := "mode=1777,pagesize=" + strconv.FormatUint(pageSize, 10)
+	err = unix.Mount("hugetlbfs", dstPath, "hugetlbfs", unix.MS_NOSUID|unix.MS_NODEV, data)
+	if err != nil {
+		return fmt.Errorf("failed to mount hugetlbfs: %w", err)
+	}
+	return nil
+}
+
+// setupControlDir creates the directory, where the VMM will create its control
+// sockets (e.g. QMP), and bind mounts it inside the monitor's rootfs. Since
+// the monitor might not run as root, the directory is owned by the monitor's
+// user.
+func setupControlDir(monRootfs string, baseDir string, user specs.User) error {
+	controlDir := filepath.Join(baseDir, hypervisors.ControlDirName)
+	err := os.MkdirAll(controlDir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", controlDir, err)
+	}
+	err = os.Chown(controlDir, int(user.UID), int(user.GID))
+	if err != nil {
+		return fmt.Errorf("failed to chown %s: %w", controlDir, err)
+	}
+
+	return fileFromHost(monRootfs, controlDir, hypervisors.MonitorControlDir, unix.MS_BIND|unix.MS_PRIVATE, false)
+}
+
+// isDynamicallyLinked returns true if the binary requires a dynamic loader
+// and hence the shared libraries of the host.
+func isDynamicallyLinked(binaryPath string) (bool, error) {
+	file, err := elf.Open(binaryPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	for _, prog := range file.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // createTmpfs creates a new tmpfs at path inside monRootfs
 // In particular, it is used for the creation of /tmp and /dev.
 // This is necessary to create the required devices for the monitor execution,
@@ -229,7 +306,8 @@ func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needs
 func createTmpfs(monRootfs string, path string, flags uint64, mode string) error {
 	dstPath := filepath.Join(monRootfs, path)
 	mountType := "tmpfs"
-	data := "mode=" + mode + ",size=65536k"
+	size := config.Get().Monitor.TmpfsSizeBytes()
+	data := "mode=" + mode + ",size=" + strconv.FormatUint(size/1024, 10) + "k"
 
 	err := os.MkdirAll(dstPath, 0755)
 	if err != nil {
@@ -0,0 +1,267 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/cgroups/v3/cgroup2/stats"
+	"github.com/opencontainers/runc/types"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urunc-dev/urunc/pkg/network"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/hypervisors"
+)
+
+// The clock ticks per second, in which /proc/<pid>/stat reports CPU times.
+// It is 100 in all the architectures we support.
+const clockTicks = 100
+
+// Stats are the statistics of a unikontainer, in the format of runc events,
+// along with the statistics that the VMM keeps for the VM
+type Stats struct {
+	types.Stats
+	// The statistics of the VMM (e.g. the exits of the vCPUs), named as
+	// the VMM reports them
+	VM map[string]uint64 `json:"vm,omitempty"`
+	// How many times the OOM killer killed a process of the cgroup
+	OOMKills uint64 `json:"-"`
+}
+
+// Stats returns the statistics of the unikontainer. Along with the resource
+// usage of the VMM (see Metrics), they include the counters of the TAP
+// devices and, for a running VM, the statistics of the VMM, if it reports
+// them. A failure to retrieve the latter two only gets logged.
+func (u *Unikontainer) Stats() (*Stats, error) {
+	status := u.Status()
+	if status == specs.StateStopped {
+		return nil, fmt.Errorf("unikontainer %s is stopped", u.State.ID)
+	}
+	metrics, err := u.Metrics()
+	if err != nil {
+		return nil, err
+	}
+	s := &Stats{Stats: runcStats(metrics)}
+	if metrics.MemoryEvents != nil {
+		s.OOMKills = metrics.MemoryEvents.OomKill
+	}
+
+	taps, err := network.TapStats(u.State.Pid)
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to retrieve the statistics of the TAP devices")
+	}
+	for name, tap := range taps {
+		s.NetworkInterfaces = append(s.NetworkInterfaces, &types.NetworkInterface{
+			Name:      name,
+			RxBytes:   tap.RxBytes,
+			RxPackets: tap.RxPackets,
+			RxErrors:  tap.RxErrors,
+			RxDropped: tap.RxDropped,
+			TxBytes:   tap.TxBytes,
+			TxPackets: tap.TxPackets,
+			TxErrors:  tap.TxErrors,
+			TxDropped: tap.TxDropped,
+		})
+	}
+	slices.SortFunc(s.NetworkInterfaces, func(a, b *types.NetworkInterface) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	if status != specs.StateRunning && status != StatePaused {
+		return s, nil
+	}
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(u.State.Annotations[annotHypervisor]))
+	if err != nil {
+		return nil, err
+	}
+	reporter, ok := vmm.(hypervisors.StatsReporter)
+	if !ok {
+		return s, nil
+	}
+	s.VM, err = reporter.VMStats(u.controlArgs())
+	if err != nil {
+		// Not every VMM reports its statistics in every setup (e.g.
+		// QEMU without KVM)
+		uniklog.WithError(err).Debug("failed to retrieve the statistics of the VMM")
+	}
+	return s, nil
+}
+
+// runcStats converts the metrics of a cgroup to the statistics of runc
+// events, as runc does for cgroup v2. The times are in nanoseconds.
+func runcStats(metrics *stats.Metrics) types.Stats {
+	var s types.Stats
+	if cpu := metrics.CPU; cpu != nil {
+		s.CPU.Usage = types.CpuUsage{
+			Total:  cpu.UsageUsec * 1000,
+			User:   cpu.UserUsec * 1000,
+			Kernel: cpu.SystemUsec * 1000,
+		}
+		s.CPU.Throttling = types.Throttling{
+			Periods:          cpu.NrPeriods,
+			ThrottledPeriods: cpu.NrThrottled,
+			ThrottledTime:    cpu.ThrottledUsec * 1000,
+		}
+	}
+	if memory := metrics.Memory; memory != nil {
+		s.Memory.Cache = memory.File
+		s.Memory.Usage = types.MemoryEntry{
+			Usage: memory.Usage,
+			Limit: memory.UsageLimit,
+		}
+		if metrics.MemoryEvents != nil {
+			s.Memory.Usage.Failcnt = metrics.MemoryEvents.Max
+		}
+		// Like cgroup v1, runc reports the memory plus the swap
+		s.Memory.Swap = types.MemoryEntry{
+			Usage: memory.Usage + memory.SwapUsage,
+			Limit: math.MaxUint64,
+		}
+		if memory.UsageLimit != math.MaxUint64 && memory.SwapLimit != math.MaxUint64 {
+			s.Memory.Swap.Limit = memory.UsageLimit + memory.SwapLimit
+		}
+		s.Memory.Raw = map[string]uint64{
+			"anon":               memory.Anon,
+			"file":               memory.File,
+			"kernel_stack":       memory.KernelStack,
+			"slab":               memory.Slab,
+			"sock":               memory.Sock,
+			"shmem":              memory.Shmem,
+			"file_mapped":        memory.FileMapped,
+			"file_dirty":         memory.FileDirty,
+			"file_writeback":     memory.FileWriteback,
+			"anon_thp":           memory.AnonThp,
+			"inactive_anon":      memory.InactiveAnon,
+			"active_anon":        memory.ActiveAnon,
+			"inactive_file":      memory.InactiveFile,
+			"active_file":        memory.ActiveFile,
+			"unevictable":        memory.Unevictable,
+			"slab_reclaimable":   memory.SlabReclaimable,
+			"slab_unreclaimable": memory.SlabUnreclaimable,
+			"pgfault":            memory.Pgfault,
+			"pgmajfault":         memory.Pgmajfault,
+		}
+	}
+	if pids := metrics.Pids; pids != nil {
+		s.Pids = types.Pids{Current: pids.Current, Limit: pids.Limit}
+	}
+	if metrics.Io != nil {
+		for _, entry := range metrics.Io.Usage {
+			s.Blkio.IoServiceBytesRecursive = append(s.Blkio.IoServiceBytesRecursive,
+				types.BlkioEntry{Major: entry.Major, Minor: entry.Minor, Op: "Read", Value: entry.Rbytes},
+				types.BlkioEntry{Major: entry.Major, Minor: entry.Minor, Op: "Write", Value: entry.Wbytes})
+			s.Blkio.IoServicedRecursive = append(s.Blkio.IoServicedRecursive,
+				types.BlkioEntry{Major: entry.Major, Minor: entry.Minor, Op: "Read", Value: entry.Rios},
+				types.BlkioEntry{Major: entry.Major, Minor: entry.Minor, Op: "Write", Value: entry.Wios})
+		}
+	}
+	s.Hugetlb = make(map[string]types.Hugetlb)
+	for _, hugetlb := range metrics.Hugetlb {
+		s.Hugetlb[hugetlb.Pagesize] = types.Hugetlb{Usage: hugetlb.Current}
+	}
+	return s
+}
+
+// Metrics returns the resource usage of the VM, as seen from the host. If the
+// monitor is in a cgroup, the statistics of the cgroup get returned.
+// Otherwise, the CPU and memory usage of the monitor process is retrieved
+// from procfs.
+func (u *Unikontainer) Metrics() (*stats.Metrics, error) {
+	if u.Cgroup != nil {
+		manager, err := u.Cgroup.manager()
+		if err != nil {
+			return nil, err
+		}
+		metrics, err := manager.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve the stats of cgroup %s: %w", u.Cgroup.Path, err)
+		}
+		return metrics, nil
+	}
+	if !u.isRunning() {
+		return nil, fmt.Errorf("unikontainer %s is not running", u.State.ID)
+	}
+	return procMetrics(filepath.Join("/proc", strconv.Itoa(u.State.Pid)))
+}
+
+// procMetrics reads the CPU and memory usage of the process with the given
+// procfs directory
+func procMetrics(procDir string) (*stats.Metrics, error) {
+	fields, err := hypervisors.ProcStatFields(procDir)
+	if err != nil {
+		return nil, err
+	}
+	// utime and stime are the 14th and 15th fields of the file
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("invalid stat file in %s", procDir)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid utime in %s: %w", procDir, err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stime in %s: %w", procDir, err)
+	}
+	usecPerTick := uint64(1000000 / clockTicks)
+	cpu := &stats.CPUStat{
+		UserUsec:   utime * usecPerTick,
+		SystemUsec: stime * usecPerTick,
+	}
+	cpu.UsageUsec = cpu.UserUsec + cpu.SystemUsec
+
+	rss, err := procRSS(filepath.Join(procDir, "status"))
+	if err != nil {
+		return nil, err
+	}
+	return &stats.Metrics{
+		CPU:    cpu,
+		Memory: &stats.MemoryStat{Usage: rss},
+	}, nil
+}
+
+// procRSS returns the resident set size in bytes, as found in the status
+// file of a process
+func procRSS(statusPath string) (uint64, error) {
+	file, err := os.Open(statusPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !found {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid VmRSS in %s: %w", statusPath, err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	// Kernel threads and zombies have no memory
+	return 0, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/cgroups/v3/cgroup2/stats"
+	"github.com/opencontainers/runc/types"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcMetrics(t *testing.T) {
+	procDir := t.TempDir()
+	stat := "1234 (qemu system) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 3 0 100 1000000 256 18446744073709551615"
+	assert.NoError(t, os.WriteFile(filepath.Join(procDir, "stat"), []byte(stat), 0o644))
+	status := "Name:\tqemu-system-x86\nVmPeak:\t  300000 kB\nVmRSS:\t  204800 kB\nThreads:\t3\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(procDir, "status"), []byte(status), 0o644))
+
+	metrics, err := procMetrics(procDir)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2500000), metrics.CPU.UserUsec)
+	assert.Equal(t, uint64(500000), metrics.CPU.SystemUsec)
+	assert.Equal(t, uint64(3000000), metrics.CPU.UsageUsec)
+	assert.Equal(t, uint64(200*1024*1024), metrics.Memory.Usage)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(procDir, "stat"), []byte("1234 (qemu) S 1"), 0o644))
+	_, err = procMetrics(procDir)
+	assert.Error(t, err)
+}
+
+func TestMetrics(t *testing.T) {
+	// Without a cgroup, the usage of the monitor comes from procfs
+	u := &Unikontainer{
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateRunning,
+			Pid:         os.Getpid(),
+			Annotations: map[string]string{},
+		},
+		Spec:    &specs.Spec{},
+		BaseDir: t.TempDir(),
+	}
+	metrics, err := u.Metrics()
+	assert.NoError(t, err)
+	assert.NotZero(t, metrics.Memory.Usage)
+
+	u.State.Pid = deadPid
+	_, err = u.Metrics()
+	assert.Error(t, err)
+}
+
+func TestRuncStats(t *testing.T) {
+	s := runcStats(&stats.Metrics{
+		CPU:          &stats.CPUStat{UsageUsec: 300, UserUsec: 200, SystemUsec: 100, NrPeriods: 10, NrThrottled: 2, ThrottledUsec: 50},
+		Memory:       &stats.MemoryStat{Usage: 4096, UsageLimit: 8192, SwapUsage: 1024, SwapLimit: math.MaxUint64, File: 512, Anon: 3584},
+		MemoryEvents: &stats.MemoryEvents{Max: 3, OomKill: 1},
+		Pids:         &stats.PidsStat{Current: 4, Limit: 100},
+		Io:           &stats.IOStat{Usage: []*stats.IOEntry{{Major: 8, Minor: 0, Rbytes: 10, Wbytes: 20, Rios: 1, Wios: 2}}},
+		Hugetlb:      []*stats.HugeTlbStat{{Pagesize: "2MB", Current: 2097152, Max: 4194304}},
+	})
+	assert.Equal(t, types.CpuUsage{Total: 300000, User: 200000, Kernel: 100000}, s.CPU.Usage)
+	assert.Equal(t, types.Throttling{Periods: 10, ThrottledPeriods: 2, ThrottledTime: 50000}, s.CPU.Throttling)
+	assert.Equal(t, types.MemoryEntry{Usage: 4096, Limit: 8192, Failcnt: 3}, s.Memory.Usage)
+	// The swap includes the memory and it is unlimited if either is
+	assert.Equal(t, types.MemoryEntry{Usage: 5120, Limit: math.MaxUint64}, s.Memory.Swap)
+	assert.Equal(t, uint64(512), s.Memory.Cache)
+	assert.Equal(t, uint64(3584), s.Memory.Raw["anon"])
+	assert.Equal(t, types.Pids{Current: 4, Limit: 100}, s.Pids)
+	assert.Equal(t, []types.BlkioEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 10},
+		{Major: 8, Minor: 0, Op: "Write", Value: 20},
+	}, s.Blkio.IoServiceBytesRecursive)
+	assert.Equal(t, []types.BlkioEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 1},
+		{Major: 8, Minor: 0, Op: "Write", Value: 2},
+	}, s.Blkio.IoServicedRecursive)
+	assert.Equal(t, map[string]types.Hugetlb{"2MB": {Usage: 2097152}}, s.Hugetlb)
+}
+
+func TestStats(t *testing.T) {
+	u := &Unikontainer{
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateCreated,
+			Pid:         os.Getpid(),
+			Annotations: map[string]string{},
+		},
+		Spec:    &specs.Spec{},
+		BaseDir: t.TempDir(),
+	}
+	s, err := u.Stats()
+	assert.NoError(t, err)
+	assert.NotZero(t, s.Memory.Usage.Usage)
+	assert.Nil(t, s.VM)
+
+	u.State.Pid = deadPid
+	_, err = u.Stats()
+	assert.ErrorContains(t, err, "is stopped")
+}
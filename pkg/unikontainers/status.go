@@ -0,0 +1,129 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// ExitStatus holds the information about the termination of the monitor
+// process. It gets stored as exit.json next to state.json.
+type ExitStatus struct {
+	ExitCode   int       `json:"exitCode"`
+	Signal     int       `json:"signal,omitempty"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// SetStopped persists the stopped state of the unikontainer along with the
+// exit status of the monitor process. Processes that reap the monitor can
+// provide its wait status. Otherwise, ws should be nil and only the stopped
+// state gets persisted, so the reaper can still record the exit status. If an
+// exit status is already recorded, it does not get overwritten.
+//
+// The reexec process execs into the monitor, so the monitor gets reaped by
+// the parent of urunc create, usually containerd-shim-urunc-v2. Hence, only
+// that process is a reliable source of its exit status. urunc finds the exit
+// status only if it polls the monitor while it is still a zombie.
+func (u *Unikontainer) SetStopped(ws *unix.WaitStatus) error {
+	exit, err := u.ExitStatus()
+	if err != nil {
+		return err
+	}
+	if exit == nil && ws != nil {
+		exit = newExitStatus(ws)
+		data, err := json.Marshal(exit)
+		if err != nil {
+			return err
+		}
+		exitFile := filepath.Join(u.BaseDir, exitFilename)
+		err = os.WriteFile(exitFile, data, 0o644) //nolint: gosec
+		if err != nil {
+			return fmt.Errorf("failed to save exit status: %w", err)
+		}
+		uniklog.WithField("id", u.State.ID).WithField("exitCode", exit.ExitCode).
+			WithField("signal", exit.Signal).Debug("Monitor exited")
+	}
+
+	if u.State.Status == specs.StateStopped {
+		return nil
+	}
+	u.State.Status = specs.StateStopped
+	return u.saveContainerState()
+}
+
+// saveExitStatusAt records the exit status in the state directory dir,
+// unless one is already recorded. The reexec process uses it, since it can
+// reach the state directory only through a file descriptor, after changing
+// its root to the rootfs of the monitor.
+func saveExitStatusAt(dir *os.File, ws *unix.WaitStatus) error {
+	data, err := json.Marshal(newExitStatus(ws))
+	if err != nil {
+		return err
+	}
+	fd, err := unix.Openat(int(dir.Fd()), exitFilename, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_CLOEXEC, 0o644)
+	if errors.Is(err, unix.EEXIST) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save exit status: %w", err)
+	}
+	file := os.NewFile(uintptr(fd), exitFilename)
+	defer file.Close()
+	_, err = file.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to save exit status: %w", err)
+	}
+	return nil
+}
+
+// ExitStatus returns the recorded exit status of the monitor process or nil,
+// if the monitor has not exited yet or its exit status is unknown.
+func (u *Unikontainer) ExitStatus() (*ExitStatus, error) {
+	data, err := os.ReadFile(filepath.Join(u.BaseDir, exitFilename))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var exit ExitStatus
+	err = json.Unmarshal(data, &exit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse exit status: %w", err)
+	}
+	return &exit, nil
+}
+
+func newExitStatus(ws *unix.WaitStatus) *ExitStatus {
+	exit := &ExitStatus{
+		ExitCode:   ws.ExitStatus(),
+		FinishedAt: time.Now().UTC(),
+	}
+	if ws.Signaled() {
+		// Follow the shell convention for processes killed by a signal
+		exit.Signal = int(ws.Signal())
+		exit.ExitCode = 128 + exit.Signal
+	}
+	return exit
+}
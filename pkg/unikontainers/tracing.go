@@ -0,0 +1,103 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"time"
+
+	"github.com/urunc-dev/urunc/internal/tracing"
+)
+
+const (
+	// The span of the reexec process, which ends right before the execve of
+	// the monitor, after every other span of the process
+	reexecSpanName = "reexec"
+	// How long to wait for the reexec process to record its spans, before
+	// exporting the trace
+	traceExportTimeout = 2 * time.Second
+)
+
+// StartTrace starts the span of the urunc command, which handles the
+// unikontainer, if tracing is enabled. The spans of the command (e.g. the
+// hooks) become its children, until EndTrace. The first span of a container
+// (i.e. the one of urunc create) gets saved in its state directory, so the
+// following commands can join its trace through TraceContext.
+func (u *Unikontainer) StartTrace(name string, parent tracing.SpanContext, start time.Time) {
+	if u.span != nil {
+		return
+	}
+	recorder, err := tracing.NewRecorder(u.BaseDir)
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to record the spans of the unikontainer")
+		return
+	}
+	if recorder == nil {
+		return
+	}
+	u.recorder = recorder
+	u.span = recorder.Start(name, parent, start)
+	u.span.SetAttribute("container.id", u.State.ID)
+	u.span.SetAttribute("urunc.hypervisor", u.State.Annotations[annotHypervisor])
+	u.span.SetAttribute("urunc.unikernel", u.State.Annotations[annotType])
+	if _, err := tracing.ReadContext(u.BaseDir); err != nil {
+		err = tracing.WriteContext(u.BaseDir, u.span.Context())
+		if err != nil {
+			uniklog.WithError(err).Warn("failed to save the trace context")
+		}
+	}
+}
+
+// SpanContext returns the context of the span of the current command, which
+// is not valid if tracing is disabled
+func (u *Unikontainer) SpanContext() tracing.SpanContext {
+	return u.span.Context()
+}
+
+// TraceContext returns the context of the first span of the unikontainer,
+// which is not valid if tracing was disabled when it got created
+func (u *Unikontainer) TraceContext() tracing.SpanContext {
+	c, err := tracing.ReadContext(u.BaseDir)
+	if err != nil {
+		return tracing.SpanContext{}
+	}
+	return c
+}
+
+// EndTrace ends the span of the current command, after which no more spans
+// get recorded. If err is not nil, the span gets marked as failed.
+func (u *Unikontainer) EndTrace(err error) {
+	u.span.End(err)
+	_ = u.recorder.Close()
+}
+
+// ExportTrace exports the spans, which the urunc commands have recorded for
+// the unikontainer. If wait is set, it first waits for the reexec process to
+// record its spans, which happens right before the execve of the monitor. A
+// failure only gets logged, since tracing should never fail a container.
+func (u *Unikontainer) ExportTrace(wait bool) {
+	until := ""
+	if wait {
+		until = reexecSpanName
+	}
+	err := tracing.Export(u.BaseDir, until, traceExportTimeout)
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to export the trace of the unikontainer")
+	}
+}
+
+// startSpan starts a child span of the span of the current command
+func (u *Unikontainer) startSpan(name string) *tracing.Span {
+	return u.span.Start(name)
+}
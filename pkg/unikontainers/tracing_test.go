@@ -0,0 +1,123 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+}
+
+func TestTrace(t *testing.T) {
+	var mu sync.Mutex
+	spans := make(map[string]testSpan)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []testSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}))
+	defer server.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_SDK_DISABLED", "")
+
+	// Every command loads its own unikontainer
+	baseDir := t.TempDir()
+	newUnikontainer := func() *Unikontainer {
+		return &Unikontainer{
+			State:   &specs.State{ID: "test", Annotations: map[string]string{annotHypervisor: "qemu"}},
+			Spec:    &specs.Spec{},
+			BaseDir: baseDir,
+		}
+	}
+
+	create := newUnikontainer()
+	create.StartTrace("create", create.TraceContext(), time.Now())
+	assert.NoError(t, create.ExecuteHooks("CreateRuntime"))
+	create.EndTrace(nil)
+
+	reexec := newUnikontainer()
+	reexec.StartTrace("reexec", create.SpanContext(), time.Now())
+	reexec.startSpan("network setup").End(nil)
+
+	start := newUnikontainer()
+	start.StartTrace("start", start.TraceContext(), time.Now())
+	start.EndTrace(nil)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		reexec.EndTrace(nil)
+	}()
+	start.ExportTrace(true)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, spans, 5)
+	root := spans["create"]
+	assert.Empty(t, root.ParentSpanID)
+	for _, span := range spans {
+		assert.Equal(t, root.TraceID, span.TraceID)
+	}
+	assert.Equal(t, root.SpanID, spans["hooks CreateRuntime"].ParentSpanID)
+	assert.Equal(t, root.SpanID, spans["reexec"].ParentSpanID)
+	assert.Equal(t, root.SpanID, spans["start"].ParentSpanID)
+	assert.Equal(t, spans["reexec"].SpanID, spans["network setup"].ParentSpanID)
+}
+
+func TestTraceDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	u := &Unikontainer{
+		State:   &specs.State{ID: "test"},
+		Spec:    &specs.Spec{},
+		BaseDir: t.TempDir(),
+	}
+	u.StartTrace("create", u.TraceContext(), time.Now())
+	assert.False(t, u.SpanContext().IsValid())
+	assert.NoError(t, u.ExecuteHooks("CreateRuntime"))
+	u.EndTrace(nil)
+	u.ExportTrace(true)
+	assert.NoFileExists(t, filepath.Join(u.BaseDir, "traceparent"))
+}
@@ -100,8 +100,13 @@ func (l *Linux) SupportsFS(fsType string) bool {
 	}
 }
 
-func (l *Linux) MonitorNetCli(_ string) string {
-	return ""
+func (l *Linux) MonitorNetCli(monitor string) string {
+	switch monitor {
+	case "kvmtool":
+		return "--network mode=tap,tapif="
+	default:
+		return ""
+	}
 }
 
 func (l *Linux) MonitorBlockCli(monitor string) string {
@@ -110,6 +115,8 @@ func (l *Linux) MonitorBlockCli(monitor string) string {
 		bcli := " -device virtio-blk-pci,id=blk0,drive=hd0"
 		bcli += " -drive format=raw,if=none,id=hd0,file="
 		return bcli
+	case "kvmtool":
+		return "--disk "
 	default:
 		return ""
 	}
@@ -119,6 +126,8 @@ func (l *Linux) MonitorCli(monitor string) string {
 	switch monitor {
 	case "qemu":
 		return " -no-reboot -serial stdio -nodefaults"
+	case "kvmtool":
+		return " --console serial"
 	default:
 		return ""
 	}
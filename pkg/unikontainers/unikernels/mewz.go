@@ -51,6 +51,9 @@ func (m *Mewz) MonitorNetCli(monitor string) string {
 		ncli := " -device virtio-net-pci,netdev=net0,disable-legacy=on,disable-modern=off"
 		ncli += " -netdev tap,script=no,downscript=no,id=net0,ifname="
 		return ncli
+	case "kvmtool":
+		// Mewz supports only modern virtio devices
+		return "--virtio-transport pci --network mode=tap,tapif="
 	default:
 		return ""
 	}
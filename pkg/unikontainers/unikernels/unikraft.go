@@ -84,8 +84,13 @@ func (u *Unikraft) SupportsFS(fsType string) bool {
 }
 
 // There is no need for any changes here yet.
-func (u *Unikraft) MonitorNetCli(_ string) string {
-	return ""
+func (u *Unikraft) MonitorNetCli(monitor string) string {
+	switch monitor {
+	case "kvmtool":
+		return "--network mode=tap,tapif="
+	default:
+		return ""
+	}
 }
 
 // We have not managed to make Unikraft run with block yet.
@@ -93,9 +98,15 @@ func (u *Unikraft) MonitorBlockCli(_ string) string {
 	return ""
 }
 
-// There are no generic CLI hypervisor options for Unikraft yet.
-func (u *Unikraft) MonitorCli(_ string) string {
-	return ""
+// There are no generic CLI hypervisor options for Unikraft yet, except
+// for the serial console in kvmtool.
+func (u *Unikraft) MonitorCli(monitor string) string {
+	switch monitor {
+	case "kvmtool":
+		return " --console serial"
+	default:
+		return ""
+	}
 }
 
 func (u *Unikraft) Init(data UnikernelParams) error {
@@ -28,6 +28,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/urunc-dev/urunc/pkg/network"
 	"github.com/urunc-dev/urunc/pkg/unikontainers/hypervisors"
@@ -35,10 +36,12 @@ import (
 	"github.com/vishvananda/netlink/nl"
 	"golang.org/x/sys/unix"
 
+	"github.com/docker/go-units"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
-	"github.com/urunc-dev/urunc/internal/constants"
+	"github.com/urunc-dev/urunc/internal/config"
 	m "github.com/urunc-dev/urunc/internal/metrics"
+	"github.com/urunc-dev/urunc/internal/tracing"
 )
 
 const (
@@ -48,15 +51,44 @@ const (
 
 var uniklog = logrus.WithField("subsystem", "unikontainers")
 
+// hostCPUs returns the number of CPUs of the host, which is the upper limit
+// of the vCPUs of a VM
+var hostCPUs = runtime.NumCPU
+
+// StatePaused is the status of a paused unikontainer. The OCI runtime spec
+// does not define it, but runc and the higher level runtimes use it.
+const StatePaused specs.ContainerState = "paused"
+
 var ErrQueueProxy = errors.New("this a queue proxy container")
 var ErrNotUnikernel = errors.New("this is not a unikernel container")
 
 // Unikontainer holds the data necessary to create, manage and delete unikernel containers
 type Unikontainer struct {
-	State   *specs.State
-	Spec    *specs.Spec
-	BaseDir string
-	RootDir string
+	State      *specs.State
+	Spec       *specs.Spec
+	BaseDir    string
+	RootDir    string
+	Created    time.Time
+	CPUPinning *CPUPinning
+	Cgroup     *Cgroup
+	// The resources of the container, if they have been updated since
+	// its creation. Otherwise, the resources are the ones of the spec.
+	Resources *specs.LinuxResources
+	// The span of the current urunc command, if tracing is enabled
+	recorder *tracing.Recorder
+	span     *tracing.Span
+}
+
+// unikontainerState is the format of state.json. It extends the OCI state
+// with any information that urunc needs to keep across invocations, but
+// it is not part of the OCI state (e.g. the creation time).
+type unikontainerState struct {
+	specs.State
+	Created    time.Time   `json:"created"`
+	CPUPinning *CPUPinning `json:"cpuPinning,omitempty"`
+	Cgroup     *Cgroup     `json:"cgroup,omitempty"`
+	// The resources of the container, as changed by urunc update
+	Resources *specs.LinuxResources `json:"resources,omitempty"`
 }
 
 // New parses the bundle and creates a new Unikontainer object
@@ -98,9 +130,25 @@ func New(bundlePath string, containerID string, rootDir string) (*Unikontainer,
 		RootDir: rootDir,
 		Spec:    spec,
 		State:   state,
+		Created: time.Now().UTC(),
 	}, nil
 }
 
+// IsUnikernel returns true if the bundle describes a unikernel, which urunc
+// runs itself, rather than a generic container, which gets handed to runc.
+// It has no side effects, so it can be called before creating the container.
+func IsUnikernel(bundlePath string) bool {
+	spec, err := loadSpec(bundlePath)
+	if err != nil {
+		return false
+	}
+	if spec.Annotations["io.kubernetes.cri.container-name"] == "queue-proxy" {
+		return false
+	}
+	_, err = GetUnikernelConfig(bundlePath, spec)
+	return err == nil
+}
+
 // Get retrieves unikernel data from disk to create a Unikontainer object
 func Get(containerID string, rootDir string) (*Unikontainer, error) {
 	u := &Unikontainer{}
@@ -113,7 +161,11 @@ func Get(containerID string, rootDir string) (*Unikontainer, error) {
 	if state.Annotations[annotType] == "" {
 		return nil, ErrNotUnikernel
 	}
-	u.State = state
+	u.State = &state.State
+	u.Created = state.Created
+	u.CPUPinning = state.CPUPinning
+	u.Cgroup = state.Cgroup
+	u.Resources = state.Resources
 
 	spec, err := loadSpec(state.Bundle)
 	if err != nil {
@@ -125,6 +177,35 @@ func Get(containerID string, rootDir string) (*Unikontainer, error) {
 	return u, nil
 }
 
+// List retrieves all unikernel containers found under rootDir. Any directory
+// which does not contain the state of a unikernel container (e.g. containers
+// handled by runc) gets ignored.
+func List(rootDir string) ([]*Unikontainer, error) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*Unikontainer{}, nil
+		}
+		return nil, err
+	}
+
+	unikontainers := make([]*Unikontainer, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		u, err := Get(entry.Name(), rootDir)
+		if err != nil {
+			if !errors.Is(err, ErrNotUnikernel) {
+				uniklog.WithError(err).WithField("id", entry.Name()).Debug("Skipping container")
+			}
+			continue
+		}
+		unikontainers = append(unikontainers, u)
+	}
+	return unikontainers, nil
+}
+
 // InitialSetup sets the Unikernel status as creating,
 // creates the Unikernel base directory and
 // saves the state.json file with the current Unikernel state
@@ -150,9 +231,10 @@ func (u *Unikontainer) Create(pid int) error {
 	return u.saveContainerState()
 }
 
-func (u *Unikontainer) Exec() error {
-	// FIXME: We need to find a way to set the output file
-	var metrics = m.NewZerologMetrics(constants.TimestampTargetFile)
+// Exec sets up the network and the rootfs of the unikontainer and execve's
+// the monitor. It captures the timestamps in metrics, which should have been
+// opened before changing the root.
+func (u *Unikontainer) Exec(metrics m.Writer) (err error) {
 	metrics.Capture(u.State.ID, "TS15")
 
 	vmmType := u.State.Annotations[annotHypervisor]
@@ -182,19 +264,15 @@ func (u *Unikontainer) Exec() error {
 		UnikernelPath: unikernelPath,
 		InitrdPath:    initrdPath,
 		BlockDevice:   "",
-		Seccomp:       true, // Enable Seccomp by default
-		MemSizeB:      0,
+		Seccomp:       u.withSeccomp(),
+		VCPUs:         u.vcpus(),
+		HugePageSize:  u.hugePageSize(),
+		Balloon:       u.withBalloon(),
+		VMMetrics:     u.withVMMetrics(),
 		Environment:   os.Environ(),
+		ExtraArgs:     u.hypervisorConfig().ExtraArgs,
 	}
-
-	// Check if memory limit was not set
-	if u.Spec.Linux.Resources.Memory != nil {
-		if u.Spec.Linux.Resources.Memory.Limit != nil {
-			if *u.Spec.Linux.Resources.Memory.Limit > 0 {
-				vmmArgs.MemSizeB = uint64(*u.Spec.Linux.Resources.Memory.Limit) // nolint:gosec
-			}
-		}
-	}
+	vmmArgs.MemSizeB = u.guestMemory(vmmArgs.HugePageSize)
 
 	// Check if container is set to unconfined -- disable seccomp
 	if u.Spec.Linux.Seccomp == nil {
@@ -219,6 +297,12 @@ func (u *Unikontainer) Exec() error {
 		unikernelParams.RootFSType = ""
 	}
 
+	// The span of the current phase, which ends when the next one starts
+	span := u.startSpan("network setup")
+	defer func() {
+		span.End(err)
+	}()
+
 	// handle network
 	networkType := u.getNetworkType()
 	uniklog.WithField("network type", networkType).Debug("Retrieved network type")
@@ -231,6 +315,8 @@ func (u *Unikontainer) Exec() error {
 	if err != nil {
 		uniklog.Errorf("Failed to setup network :%v. Possibly due to ctr", err)
 	}
+	span.End(err)
+	span = u.startSpan("rootfs preparation")
 	metrics.Capture(u.State.ID, "TS16")
 
 	withTUNTAP := false
@@ -339,6 +425,7 @@ func (u *Unikontainer) Exec() error {
 			}
 		}
 	}
+	span.End(nil)
 	metrics.Capture(u.State.ID, "TS17")
 
 	err = unikernel.Init(unikernelParams)
@@ -355,6 +442,12 @@ func (u *Unikontainer) Exec() error {
 	}
 	vmmArgs.Command = unikernelCmd
 
+	// Restrict the monitor to the cpuset of the container
+	err = u.pinMonitor()
+	if err != nil {
+		return err
+	}
+
 	// update urunc.json state
 	// TODO: Move this somewhere else. We are not yet running and
 	// maybe we need to make sure the monitor started correctly before
@@ -376,6 +469,7 @@ func (u *Unikontainer) Exec() error {
 
 	// Make sure that rootfs is mounted with the correct propagation
 	// flags so we can later pivot if needed.
+	span = u.startSpan("monitor exec")
 	err = prepareRoot(monRootfs, u.Spec.Linux.RootfsPropagation)
 	if err != nil {
 		return err
@@ -383,11 +477,19 @@ func (u *Unikontainer) Exec() error {
 
 	// Setup the rootfs for the the monitor execution, creating necessary
 	// devices and the monitor's binary.
-	err = prepareMonRootfs(monRootfs, vmm.Path(), dmPath, vmm.UsesKVM(), withTUNTAP)
+	err = prepareMonRootfs(monRootfs, vmm.Path(), dmPath, vmm.UsesKVM(), withTUNTAP, vmmArgs.HugePageSize)
 	if err != nil {
 		return err
 	}
 
+	// Share a directory with the monitor for its control sockets
+	err = setupControlDir(monRootfs, u.BaseDir, u.Spec.Process.User)
+	if err != nil {
+		return err
+	}
+	vmmArgs.ControlDir = hypervisors.MonitorControlDir
+	vmmArgs.WithAPI = u.withVMMAPI()
+
 	if unikernelParams.RootFSType == "9pfs" {
 		// Mount the container's image rootfs inside the monitor rootfs
 		err := fileFromHost(monRootfs, rootfsDir, containerRootfsMountPath, unix.MS_BIND|unix.MS_PRIVATE, false)
@@ -406,6 +508,14 @@ func (u *Unikontainer) Exec() error {
 		}
 	}
 
+	// Keep the state directory open, in order to record the exit status,
+	// if the VMM returns
+	stateDir, err := os.Open(u.BaseDir)
+	if err != nil {
+		return err
+	}
+	defer stateDir.Close()
+
 	withPivot := containsNS(u.Spec.Linux.Namespaces, specs.MountNamespace)
 	err = changeRoot(monRootfs, withPivot)
 	if err != nil {
@@ -419,8 +529,23 @@ func (u *Unikontainer) Exec() error {
 	}
 	uniklog.Debug("calling vmm execve")
 	metrics.Capture(u.State.ID, "TS18")
+	// Nothing gets recorded after a successful execve
+	span.End(nil)
+	u.EndTrace(nil)
 	// metrics.Wait()
-	return vmm.Execve(vmmArgs, unikernel)
+	err = vmm.Execve(vmmArgs, unikernel)
+	// Execve returns only if it failed or, in the case of Hedge, when the
+	// VM stops. Either way, the reexec process exits right after (with 1 on
+	// failure), so record its exit status instead of waiting for a poll.
+	ws := unix.WaitStatus(0)
+	if err != nil {
+		ws = unix.WaitStatus(1 << 8)
+	}
+	saveErr := saveExitStatusAt(stateDir, &ws)
+	if saveErr != nil {
+		uniklog.WithError(saveErr).Warn("failed to record the exit status of the monitor")
+	}
+	return err
 }
 
 func setupUser(user specs.User) error {
@@ -447,40 +572,336 @@ func setupUser(user specs.User) error {
 	return nil
 }
 
-// Kill stops the VMM process, first by asking the VMM struct to stop
-// and consequently by killing the process described in u.State.Pid
-func (u *Unikontainer) Kill() error {
+// Kill delivers the given signal to the unikontainer. A SIGTERM to a
+// running (or paused) unikontainer asks the VMM to shut down the guest,
+// without waiting for it. Escalating to SIGKILL is up to the caller (see Stop
+// for the blocking variant). Any other signal gets delivered directly to the
+// monitor process. The network cleanup
+// takes place in Delete, since we have to make sure that the VM has exited.
+func (u *Unikontainer) Kill(sig unix.Signal) error {
+	status := u.Status()
+	if status == specs.StateStopped {
+		uniklog.WithField("id", u.State.ID).Debug("unikontainer is already stopped")
+		return nil
+	}
+	if (status == specs.StateRunning || status == StatePaused) && sig == unix.SIGTERM {
+		return u.shutdown(0)
+	}
+	if status == StatePaused && sig == unix.SIGKILL {
+		// A frozen monitor might not handle the signal, until it gets thawed
+		err := u.Resume()
+		if err != nil {
+			uniklog.WithError(err).Warn("failed to resume the paused unikontainer")
+		}
+	}
+
+	err := unix.Kill(u.State.Pid, sig)
+	if err != nil && !errors.Is(err, unix.ESRCH) {
+		return fmt.Errorf("failed to send %s to %d: %w", unix.SignalName(sig), u.State.Pid, err)
+	}
+	if sig != unix.SIGKILL {
+		return nil
+	}
+
+	// SIGKILL can not get caught and hence the monitor will exit shortly.
+	// Wait for it, so a subsequent Delete will not find it running.
+	deadline := time.Now().Add(hypervisors.KillTimeout)
+	for u.isRunning() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("unikontainer %s did not exit after SIGKILL", u.State.ID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// Stop asks the VMM to shut down the guest, giving it the chance to flush
+// its state. If the guest does not shut down within the stop timeout, the
+// monitor gets killed. The timeout can be set with the stopTimeout annotation.
+func (u *Unikontainer) Stop() error {
+	switch u.Status() {
+	case specs.StateStopped:
+		return nil
+	case specs.StateCreated:
+		// The monitor has not started yet and hence there is no guest
+		return u.Kill(unix.SIGKILL)
+	}
+
+	err := u.shutdown(u.stopTimeout())
+	if err != nil {
+		return err
+	}
+	// Persist the stopped state
+	if u.isRunning() {
+		return fmt.Errorf("unikontainer %s is still running", u.State.ID)
+	}
+	return nil
+}
+
+// shutdown asks the VMM to shut down the guest, resuming it first if it is
+// paused. With a zero timeout, it does not wait for the guest to shut down.
+func (u *Unikontainer) shutdown(timeout time.Duration) error {
 	vmmType := u.State.Annotations[annotHypervisor]
 	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
 	if err != nil {
 		return err
 	}
-	err = vmm.Stop(u.State.ID)
+	if u.State.Status == StatePaused {
+		// A paused guest can not shut down
+		err = vmm.Resume(u.controlArgs())
+		if err != nil {
+			uniklog.WithError(err).Warn("failed to resume the paused guest")
+		}
+	}
+	return vmm.Stop(hypervisors.StopArgs{
+		Container: u.State.ID,
+		Pid:       u.State.Pid,
+		BaseDir:   u.BaseDir,
+		Timeout:   timeout,
+	})
+}
+
+// Pause pauses the execution of a running unikontainer
+func (u *Unikontainer) Pause() error {
+	if u.Status() != specs.StateRunning {
+		return fmt.Errorf("unikontainer %s is not running", u.State.ID)
+	}
+	vmm, err := u.pausableVMM()
 	if err != nil {
 		return err
 	}
+	err = vmm.Pause(u.controlArgs())
+	if err != nil {
+		return fmt.Errorf("failed to pause unikontainer %s: %w", u.State.ID, err)
+	}
+	u.State.Status = StatePaused
+	return u.saveContainerState()
+}
+
+// Resume resumes the execution of a paused unikontainer
+func (u *Unikontainer) Resume() error {
+	if u.Status() != StatePaused {
+		return fmt.Errorf("unikontainer %s is not paused", u.State.ID)
+	}
+	vmm, err := u.pausableVMM()
+	if err != nil {
+		return err
+	}
+	err = vmm.Resume(u.controlArgs())
+	if err != nil {
+		return fmt.Errorf("failed to resume unikontainer %s: %w", u.State.ID, err)
+	}
+	u.State.Status = specs.StateRunning
+	return u.saveContainerState()
+}
+
+// BalloonStats returns the statistics of the balloon device of a running
+// unikontainer
+func (u *Unikontainer) BalloonStats() (*hypervisors.BalloonStats, error) {
+	status := u.Status()
+	if status != specs.StateRunning && status != StatePaused {
+		return nil, fmt.Errorf("unikontainer %s is not running", u.State.ID)
+	}
+	if !u.withBalloon() {
+		return nil, fmt.Errorf("unikontainer %s does not have a balloon device", u.State.ID)
+	}
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return nil, err
+	}
+	reporter, ok := vmm.(hypervisors.BalloonReporter)
+	if !ok {
+		return nil, fmt.Errorf("%s does not support a balloon device", vmmType)
+	}
+	return reporter.BalloonStats(u.controlArgs())
+}
+
+// pausableVMM returns the VMM of the unikontainer, if it supports pause
+func (u *Unikontainer) pausableVMM() (hypervisors.VMM, error) {
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return nil, err
+	}
+	if !vmm.SupportsPause() {
+		return nil, fmt.Errorf("%s does not support pause and resume", vmmType)
+	}
+	return vmm, nil
+}
+
+// controlArgs returns the data the VMM needs to control the running VM
+func (u *Unikontainer) controlArgs() hypervisors.ControlArgs {
+	return hypervisors.ControlArgs{
+		Container: u.State.ID,
+		Pid:       u.State.Pid,
+		BaseDir:   u.BaseDir,
+		MemSizeB:  u.guestMemory(u.hugePageSize()),
+	}
+}
+
+// stopTimeout returns the time to wait for the guest to shut down
+func (u *Unikontainer) stopTimeout() time.Duration {
+	value := u.State.Annotations[annotStopTimeout]
+	if value == "" {
+		return hypervisors.DefaultStopTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		uniklog.WithField(annotStopTimeout, value).Warn("invalid stop timeout, using the default")
+		return hypervisors.DefaultStopTimeout
+	}
+	return timeout
+}
+
+// guestMemory returns the memory of the VM in bytes, or 0 for the default
+// memory of the monitor. It is the memory limit of the container or, without
+// a limit, the memory annotation or the default memory of the hypervisor in
+// the urunc configuration. It gets rounded up to a multiple of the hugepage
+// size, if hugepages back the guest memory.
+func (u *Unikontainer) guestMemory(hugePageSize uint64) uint64 {
+	var memSize uint64
+	if u.Spec.Linux != nil && u.Spec.Linux.Resources != nil && u.Spec.Linux.Resources.Memory != nil {
+		limit := u.Spec.Linux.Resources.Memory.Limit
+		if limit != nil && *limit > 0 {
+			memSize = uint64(*limit) // nolint:gosec
+		}
+	}
+	if memSize == 0 {
+		memSize = u.defaultMemory()
+	}
+	if hugePageSize == 0 {
+		return memSize
+	}
+	if memSize == 0 {
+		memSize = hypervisors.DefaultMemory * 1024 * 1024
+	}
+	pages := (memSize + hugePageSize - 1) / hugePageSize
+	return pages * hugePageSize
+}
+
+// defaultMemory returns the memory of the VM in bytes for a container
+// without a memory limit, as set by the memory annotation or the urunc
+// configuration, or 0 for the default memory of the monitor.
+func (u *Unikontainer) defaultMemory() uint64 {
+	if value := u.State.Annotations[annotMemory]; value != "" {
+		size, err := units.RAMInBytes(value)
+		if err == nil && size > 0 {
+			return uint64(size)
+		}
+		uniklog.WithField(annotMemory, value).Warn("invalid memory, ignoring the annotation")
+	}
+	return u.hypervisorConfig().DefaultMemoryBytes()
+}
+
+// vcpus returns the number of vCPUs of the VM, as requested for the
+// container (see requestedVCPUs), up to the number of CPUs of the host and
+// the maximum number of vCPUs of the VMM.
+func (u *Unikontainer) vcpus() uint {
+	vcpus := u.requestedVCPUs()
+	limit := uint(hostCPUs()) //nolint: gosec
+	vmmType := hypervisors.VmmType(u.State.Annotations[annotHypervisor])
+	if vmmLimit := hypervisors.MaxVCPUs(vmmType); vmmLimit > 0 && vmmLimit < limit {
+		limit = vmmLimit
+	}
+	if vcpus > limit {
+		uniklog.WithField("vcpus", vcpus).WithField("limit", limit).Warn("too many vCPUs, limiting them")
+		return limit
+	}
+	return vcpus
+}
+
+// requestedVCPUs returns the number of vCPUs requested for the container.
+// By default, it is derived from the CPU limit (quota/period) and the
+// cpuset of the container, taking the smallest of the two, or it is the
+// default_vcpus of the hypervisor in the urunc configuration. The vcpus
+// annotation overrides all of them.
+func (u *Unikontainer) requestedVCPUs() uint {
+	if value := u.State.Annotations[annotVCPUs]; value != "" {
+		vcpus, err := strconv.ParseUint(value, 10, 32)
+		if err == nil && vcpus > 0 {
+			return uint(vcpus)
+		}
+		uniklog.WithField(annotVCPUs, value).Warn("invalid number of vCPUs, ignoring the annotation")
+	}
 
-	// Check if pid is running
-	if syscall.Kill(u.State.Pid, syscall.Signal(0)) == nil {
-		err = syscall.Kill(u.State.Pid, unix.SIGKILL)
+	vcpus := hypervisors.DefaultVCPUs
+	if configured := u.hypervisorConfig().DefaultVCPUs; configured > 0 {
+		vcpus = configured
+	}
+	if u.Spec.Linux == nil || u.Spec.Linux.Resources == nil || u.Spec.Linux.Resources.CPU == nil {
+		return vcpus
+	}
+	cpu := u.Spec.Linux.Resources.CPU
+	limit := uint(0)
+	if cpu.Quota != nil && *cpu.Quota > 0 && cpu.Period != nil && *cpu.Period > 0 {
+		// Round up, so a limit of 1.5 CPUs gets 2 vCPUs
+		period := *cpu.Period
+		quota := uint64(*cpu.Quota)
+		limit = uint((quota + period - 1) / period)
+	}
+	if cpu.Cpus != "" {
+		cpus, err := parseCPUList(cpu.Cpus)
 		if err != nil {
-			return err
+			uniklog.WithError(err).Warn("failed to parse the cpuset of the container")
+		} else if limit == 0 || uint(len(cpus)) < limit {
+			limit = uint(len(cpus))
+		}
+	}
+	if limit > 0 {
+		vcpus = limit
+	}
+	return vcpus
+}
+
+// hugePageSize returns the size of the hugepages which should back the guest
+// memory, or 0 for regular pages. By default, it is the page size of the
+// first non-zero hugepage limit of the container. The hugepages annotation
+// overrides it.
+func (u *Unikontainer) hugePageSize() uint64 {
+	if value := u.State.Annotations[annotHugepages]; value != "" {
+		if enabled, err := strconv.ParseBool(value); err == nil && !enabled {
+			return 0
+		}
+		size, err := parseHugePageSize(value)
+		if err == nil {
+			return size
+		}
+		uniklog.WithError(err).Warn("invalid hugepages annotation, ignoring it")
+	}
+
+	if u.Spec.Linux == nil || u.Spec.Linux.Resources == nil {
+		return 0
+	}
+	for _, limit := range u.Spec.Linux.Resources.HugepageLimits {
+		if limit.Limit == 0 {
+			continue
 		}
+		size, err := parseHugePageSize(limit.Pagesize)
+		if err != nil {
+			uniklog.WithError(err).Warn("invalid hugepage limit, ignoring it")
+			continue
+		}
+		return size
 	}
-	// If PID is running we need to kill the process
+	return 0
+}
+
+// cleanupNetwork removes the TAP device, along with the TC rules, we created
+// in the network namespace of the sandbox.
+func (u *Unikontainer) cleanupNetwork() {
 	// Once the process is dead, we need to enter the network namespace
 	// and delete the TC rules and TAP device
-	err = u.joinSandboxNetNs()
+	err := u.joinSandboxNetNs()
 	if err != nil {
 		uniklog.Errorf("failed to join sandbox netns: %v", err)
-		return nil
+		return
 	}
 	// TODO: tap0_urunc should not be hardcoded
 	err = network.Cleanup("tap0_urunc")
 	if err != nil {
 		uniklog.Errorf("failed to delete tap0_urunc: %v", err)
 	}
-	return nil
 }
 
 // Delete removes the containers base directory and its contents
@@ -488,6 +909,13 @@ func (u *Unikontainer) Delete() error {
 	if u.isRunning() {
 		return fmt.Errorf("cannot delete running unikernel: %s", u.State.ID)
 	}
+	if u.Spec.Linux != nil {
+		u.cleanupNetwork()
+	}
+	err := u.removeCgroup()
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to remove the cgroup of the monitor")
+	}
 	// Make sure paths are clean
 	bundleDir := filepath.Clean(u.State.Bundle)
 	rootfsDir := filepath.Clean(u.Spec.Root.Path)
@@ -498,7 +926,7 @@ func (u *Unikontainer) Delete() error {
 	// Check if we used a different directory for monitor's rootfs than the
 	// container's one.
 	withRootfsMount := false
-	withRootfsMount, err := strconv.ParseBool(u.State.Annotations[annotMountRootfs])
+	withRootfsMount, err = strconv.ParseBool(u.State.Annotations[annotMountRootfs])
 	if err != nil {
 		withRootfsMount = false
 	}
@@ -545,6 +973,9 @@ func (u *Unikontainer) Delete() error {
 			return fmt.Errorf("cannot remove /usr: %v", err)
 		}
 	}
+	// Export any spans that did not get exported on start (e.g. the
+	// creation failed)
+	u.ExportTrace(false)
 	return os.RemoveAll(u.BaseDir)
 }
 
@@ -606,7 +1037,13 @@ func (u *Unikontainer) saveContainerState() error {
 		}
 	}
 
-	data, err := json.Marshal(u.State)
+	data, err := json.Marshal(unikontainerState{
+		State:      *u.State,
+		Created:    u.Created,
+		CPUPinning: u.CPUPinning,
+		Cgroup:     u.Cgroup,
+		Resources:  u.Resources,
+	})
 	if err != nil {
 		return err
 	}
@@ -615,7 +1052,11 @@ func (u *Unikontainer) saveContainerState() error {
 	return os.WriteFile(stateName, data, 0o644) //nolint: gosec
 }
 
-func (u *Unikontainer) ExecuteHooks(name string) error {
+func (u *Unikontainer) ExecuteHooks(name string) (err error) {
+	span := u.startSpan("hooks " + name)
+	defer func() {
+		span.End(err)
+	}()
 	// NOTICE: This wrapper function provides an easy way to toggle between
 	// the sequential and concurrent hook execution. By default the hooks are executed concurrently.
 	// To execute hooks sequentially, change the following line to:
@@ -779,10 +1220,10 @@ func (u *Unikontainer) executeHooksSequentially(name string) error {
 	return nil
 }
 
-// loadUnikontainerState returns a specs.State object containing the info
+// loadUnikontainerState returns a unikontainerState object containing the info
 // found in stateFilePath
-func loadUnikontainerState(stateFilePath string) (*specs.State, error) {
-	var state specs.State
+func loadUnikontainerState(stateFilePath string) (*unikontainerState, error) {
+	var state unikontainerState
 	data, err := os.ReadFile(stateFilePath)
 	if err != nil {
 		return nil, err
@@ -1036,15 +1477,150 @@ func (u *Unikontainer) SendStartExecve() error {
 	return sendIPCMessageWithRetry(sockAddr, StartExecve, true)
 }
 
-// isRunning returns true if the PID is alive or hedge.ListVMs returns our containerID
+// ConfigureVMM configures and boots the VM, if the VMM runs in API mode.
+// It should be called after SendStartExecve and it waits for the monitor
+// to start.
+func (u *Unikontainer) ConfigureVMM() error {
+	if !u.withVMMAPI() {
+		return nil
+	}
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return err
+	}
+	configurator, ok := vmm.(hypervisors.APIConfigurator)
+	if !ok {
+		return nil
+	}
+	return configurator.ConfigureVM(u.BaseDir)
+}
+
+// Start starts the monitor of a created unikontainer and, in API mode,
+// boots the VM. The VM is already running once the vCPUs get pinned, so a
+// failure to pin them does not fail the start. The state records whether
+// they got pinned.
+func (u *Unikontainer) Start() error {
+	err := u.SendStartExecve()
+	if err != nil {
+		return err
+	}
+	err = u.ConfigureVMM()
+	if err != nil {
+		return err
+	}
+	err = u.PinVCPUs()
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to pin the vCPUs")
+	}
+	return nil
+}
+
+// withVMMAPI returns true if the VM should get configured through the API
+// of the VMM
+func (u *Unikontainer) withVMMAPI() bool {
+	withAPI, err := strconv.ParseBool(u.State.Annotations[annotVMMAPI])
+	return err == nil && withAPI
+}
+
+// withBalloon returns true if the VM should have a balloon device
+func (u *Unikontainer) withBalloon() bool {
+	balloon, err := strconv.ParseBool(u.State.Annotations[annotBalloon])
+	return err == nil && balloon
+}
+
+// withSeccomp returns true if the VMM should run with seccomp filters, as
+// set in the urunc configuration, which enables them by default. The seccomp
+// annotation can only enable them, so a container can not disable the
+// filters that the node enforces.
+func (u *Unikontainer) withSeccomp() bool {
+	enabled := u.hypervisorConfig().SeccompEnabled()
+	value := u.State.Annotations[annotSeccomp]
+	if value == "" {
+		return enabled
+	}
+	seccomp, err := strconv.ParseBool(value)
+	switch {
+	case err != nil:
+		uniklog.WithField(annotSeccomp, value).Warn("invalid seccomp annotation, ignoring it")
+	case seccomp:
+		return true
+	case enabled:
+		uniklog.WithField(annotSeccomp, value).Warn("seccomp is enabled in the urunc configuration, ignoring the annotation")
+	}
+	return enabled
+}
+
+// hypervisorConfig returns the configuration of the hypervisor of the
+// unikontainer in the urunc configuration
+func (u *Unikontainer) hypervisorConfig() config.Hypervisor {
+	return config.Get().Hypervisor(u.State.Annotations[annotHypervisor])
+}
+
+// withVMMetrics returns true if the VMM should export its metrics
+func (u *Unikontainer) withVMMetrics() bool {
+	metrics, err := strconv.ParseBool(u.State.Annotations[annotVMMetrics])
+	return err == nil && metrics
+}
+
+// Status returns the actual status of the unikontainer. The status stored in
+// state.json can not be trusted, since urunc is not notified when the monitor
+// exits. Therefore, for created and running unikontainers we also check if
+// the reexec/monitor process (or the VM in the case of Hedge) is still alive.
+// In case it is not, the stopped state gets persisted.
+func (u *Unikontainer) Status() specs.ContainerState {
+	switch u.State.Status {
+	case specs.StateCreated, specs.StateRunning, StatePaused:
+		if u.isRunning() {
+			return u.State.Status
+		}
+		return specs.StateStopped
+	default:
+		return u.State.Status
+	}
+}
+
+// isRunning returns true if the reexec/monitor process is alive or
+// hedge.ListVMs returns our containerID. If an exit status has been
+// recorded, the unikontainer is considered stopped without any further checks.
 func (u *Unikontainer) isRunning() bool {
-	vmmType := hypervisors.VmmType(u.State.Annotations[annotType])
-	if vmmType != hypervisors.HedgeVmm {
-		return syscall.Kill(u.State.Pid, syscall.Signal(0)) == nil
+	exit, err := u.ExitStatus()
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to retrieve exit status")
 	}
-	hedge := hypervisors.Hedge{}
-	state := hedge.VMState(u.State.ID)
-	return state == "running"
+	if exit != nil {
+		return false
+	}
+
+	// A Hedge VM runs in the host kernel and it can outlive the reexec
+	// process, which streams its console.
+	vmmType := hypervisors.VmmType(u.State.Annotations[annotHypervisor])
+	if vmmType == hypervisors.HedgeVmm && u.State.Status == specs.StateRunning {
+		hedge := hypervisors.Hedge{}
+		if hedge.VMState(u.State.ID) == "running" {
+			return true
+		}
+	}
+
+	exited, ws := hypervisors.ProcessExited(u.State.Pid)
+	if !exited {
+		return true
+	}
+	err = u.SetStopped(ws)
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to persist stopped state")
+	}
+	return false
+}
+
+// UnikernelType returns the type of the unikernel running in the unikontainer
+func (u *Unikontainer) UnikernelType() string {
+	return u.State.Annotations[annotType]
+}
+
+// Hypervisor returns the monitor which executes the unikernel
+func (u *Unikontainer) Hypervisor() string {
+	return u.State.Annotations[annotHypervisor]
 }
 
 // getNetworkType checks if current container is a knative user-container
@@ -0,0 +1,415 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/urunc-dev/urunc/internal/config"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/hypervisors"
+	"golang.org/x/sys/unix"
+)
+
+// deadPid is larger than the maximum value of pid_max in Linux (2^22),
+// hence it can never belong to a running process.
+const deadPid = 1<<22 + 1
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   specs.ContainerState
+		pid      int
+		expected specs.ContainerState
+	}{
+		{"creating", specs.StateCreating, -1, specs.StateCreating},
+		{"created with alive reexec", specs.StateCreated, os.Getpid(), specs.StateCreated},
+		{"created with dead reexec", specs.StateCreated, deadPid, specs.StateStopped},
+		{"running with alive monitor", specs.StateRunning, os.Getpid(), specs.StateRunning},
+		{"running with dead monitor", specs.StateRunning, deadPid, specs.StateStopped},
+		{"running without pid", specs.StateRunning, -1, specs.StateStopped},
+		{"paused with alive monitor", StatePaused, os.Getpid(), StatePaused},
+		{"paused with dead monitor", StatePaused, deadPid, specs.StateStopped},
+		{"stopped", specs.StateStopped, os.Getpid(), specs.StateStopped},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &Unikontainer{
+				State: &specs.State{
+					ID:          "test",
+					Status:      tc.status,
+					Pid:         tc.pid,
+					Annotations: map[string]string{},
+				},
+				Spec:    &specs.Spec{},
+				BaseDir: t.TempDir(),
+			}
+			assert.Equal(t, tc.expected, u.Status())
+		})
+	}
+}
+
+func TestSetStopped(t *testing.T) {
+	u := &Unikontainer{
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateRunning,
+			Pid:         os.Getpid(),
+			Annotations: map[string]string{},
+		},
+		Spec:    &specs.Spec{},
+		BaseDir: t.TempDir(),
+	}
+	exit, err := u.ExitStatus()
+	assert.NoError(t, err)
+	assert.Nil(t, exit)
+
+	// Without a wait status, no exit status should be made up
+	assert.NoError(t, u.SetStopped(nil))
+	assert.Equal(t, specs.StateStopped, u.State.Status)
+	exit, err = u.ExitStatus()
+	assert.NoError(t, err)
+	assert.Nil(t, exit)
+
+	// The reaper of the monitor can still record its exit status
+	ws := unix.WaitStatus(1 << 8)
+	assert.NoError(t, u.SetStopped(&ws))
+	exit, err = u.ExitStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, exit.ExitCode)
+	assert.False(t, exit.FinishedAt.IsZero(), "Expected finished time to be set")
+
+	// The first recorded exit status should be kept
+	ws = unix.WaitStatus(0)
+	assert.NoError(t, u.SetStopped(&ws))
+	exit, err = u.ExitStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, exit.ExitCode)
+
+	// The stopped state should be persisted, even if the pid is alive
+	state, err := loadUnikontainerState(filepath.Join(u.BaseDir, stateFilename))
+	assert.NoError(t, err)
+	assert.Equal(t, specs.StateStopped, state.Status)
+	assert.False(t, u.isRunning())
+}
+
+func TestSaveExitStatusAt(t *testing.T) {
+	u := &Unikontainer{
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateRunning,
+			Pid:         os.Getpid(),
+			Annotations: map[string]string{},
+		},
+		Spec:    &specs.Spec{},
+		BaseDir: t.TempDir(),
+	}
+	dir, err := os.Open(u.BaseDir)
+	assert.NoError(t, err)
+	defer dir.Close()
+
+	ws := unix.WaitStatus(1 << 8)
+	assert.NoError(t, saveExitStatusAt(dir, &ws))
+	// The first recorded exit status should be kept
+	ws = unix.WaitStatus(0)
+	assert.NoError(t, saveExitStatusAt(dir, &ws))
+	exit, err := u.ExitStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, exit.ExitCode)
+
+	// A recorded exit status stops the unikontainer, even if the pid is alive
+	assert.Equal(t, specs.StateStopped, u.Status())
+}
+
+func TestStatusRecordsExitCode(t *testing.T) {
+	// The child will remain a zombie, since we do not wait for it
+	cmd := exec.Command("sh", "-c", "exit 3")
+	assert.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Wait() }()
+
+	u := &Unikontainer{
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateRunning,
+			Pid:         cmd.Process.Pid,
+			Annotations: map[string]string{},
+		},
+		Spec:    &specs.Spec{},
+		BaseDir: t.TempDir(),
+	}
+	assert.Eventually(t, func() bool {
+		return u.Status() == specs.StateStopped
+	}, 5*time.Second, 10*time.Millisecond)
+
+	exit, err := u.ExitStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, exit.ExitCode)
+	assert.Equal(t, 0, exit.Signal)
+}
+
+func TestList(t *testing.T) {
+	rootDir := t.TempDir()
+	bundleDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(bundleDir, configFilename), []byte(`{"ociVersion": "1.2.1"}`), 0o644)
+	assert.NoError(t, err)
+
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	u := &Unikontainer{
+		State: &specs.State{
+			ID:     "uni",
+			Status: specs.StateCreated,
+			Pid:    os.Getpid(),
+			Bundle: bundleDir,
+			Annotations: map[string]string{
+				annotType:       "rumprun",
+				annotHypervisor: "hvt",
+			},
+		},
+		Spec:    &specs.Spec{},
+		BaseDir: filepath.Join(rootDir, "uni"),
+		RootDir: rootDir,
+		Created: created,
+	}
+	assert.NoError(t, os.MkdirAll(u.BaseDir, 0o755))
+	assert.NoError(t, u.saveContainerState())
+
+	// A container without any urunc annotations should get ignored
+	runcDir := filepath.Join(rootDir, "runc")
+	assert.NoError(t, os.MkdirAll(runcDir, 0o755))
+	err = os.WriteFile(filepath.Join(runcDir, stateFilename), []byte(`{"id": "runc"}`), 0o644)
+	assert.NoError(t, err)
+
+	list, err := List(rootDir)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "uni", list[0].State.ID)
+	assert.Equal(t, "rumprun", list[0].UnikernelType())
+	assert.Equal(t, "hvt", list[0].Hypervisor())
+	assert.True(t, created.Equal(list[0].Created), "Expected created time to be preserved")
+
+	list, err = List(filepath.Join(rootDir, "nonexistent"))
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestKill(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	assert.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Wait() }()
+
+	u := &Unikontainer{
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateRunning,
+			Pid:         cmd.Process.Pid,
+			Annotations: map[string]string{},
+		},
+		Spec:    &specs.Spec{},
+		BaseDir: t.TempDir(),
+	}
+	assert.NoError(t, u.Kill(unix.SIGKILL))
+	assert.Equal(t, specs.StateStopped, u.Status())
+
+	exit, err := u.ExitStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, int(unix.SIGKILL), exit.Signal)
+	assert.Equal(t, 128+int(unix.SIGKILL), exit.ExitCode)
+
+	// Killing a stopped unikontainer should not fail
+	assert.NoError(t, u.Kill(unix.SIGTERM))
+}
+
+// withHostCPUs makes the host seem to have n CPUs, until the returned
+// function gets called
+func withHostCPUs(n int) func() {
+	saved := hostCPUs
+	hostCPUs = func() int { return n }
+	return func() { hostCPUs = saved }
+}
+
+func TestVCPUs(t *testing.T) {
+	defer withHostCPUs(64)()
+	quota := int64(150000)
+	period := uint64(100000)
+	tests := []struct {
+		name        string
+		cpu         *specs.LinuxCPU
+		annotations map[string]string
+		expected    uint
+	}{
+		{"no limits", nil, nil, 1},
+		{"quota", &specs.LinuxCPU{Quota: &quota, Period: &period}, nil, 2},
+		{"cpuset", &specs.LinuxCPU{Cpus: "0-2,5"}, nil, 4},
+		{"quota and cpuset", &specs.LinuxCPU{Quota: &quota, Period: &period, Cpus: "0-3"}, nil, 2},
+		{"invalid cpuset", &specs.LinuxCPU{Cpus: "3-1"}, nil, 1},
+		{"annotation", &specs.LinuxCPU{Cpus: "0-3"}, map[string]string{annotVCPUs: "8"}, 8},
+		{"invalid annotation", &specs.LinuxCPU{Cpus: "0-3"}, map[string]string{annotVCPUs: "0"}, 4},
+		{"host CPUs", nil, map[string]string{annotVCPUs: "64"}, 64},
+		{"above host CPUs", nil, map[string]string{annotVCPUs: "65"}, 64},
+		{"firecracker", nil, map[string]string{annotVCPUs: "32", annotHypervisor: "firecracker"}, 32},
+		{"above firecracker", nil, map[string]string{annotVCPUs: "33", annotHypervisor: "firecracker"}, 32},
+		{"above qemu", nil, map[string]string{annotVCPUs: "33", annotHypervisor: "qemu"}, 33},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &Unikontainer{
+				State: &specs.State{
+					ID:          "test",
+					Annotations: tc.annotations,
+				},
+				Spec: &specs.Spec{
+					Linux: &specs.Linux{
+						Resources: &specs.LinuxResources{CPU: tc.cpu},
+					},
+				},
+			}
+			assert.Equal(t, tc.expected, u.vcpus())
+		})
+	}
+}
+
+func TestHugePageSize(t *testing.T) {
+	const mib = 1024 * 1024
+	limits := []specs.LinuxHugepageLimit{
+		{Pagesize: "1GB", Limit: 0},
+		{Pagesize: "2MB", Limit: 512 * mib},
+	}
+	tests := []struct {
+		name        string
+		limits      []specs.LinuxHugepageLimit
+		annotations map[string]string
+		expected    uint64
+	}{
+		{"no limits", nil, nil, 0},
+		{"limits", limits, nil, 2 * mib},
+		{"annotation", nil, map[string]string{annotHugepages: "1G"}, 1024 * mib},
+		{"disabled", limits, map[string]string{annotHugepages: "false"}, 0},
+		{"invalid annotation", limits, map[string]string{annotHugepages: "huge"}, 2 * mib},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &Unikontainer{
+				State: &specs.State{
+					ID:          "test",
+					Annotations: tc.annotations,
+				},
+				Spec: &specs.Spec{
+					Linux: &specs.Linux{
+						Resources: &specs.LinuxResources{HugepageLimits: tc.limits},
+					},
+				},
+			}
+			assert.Equal(t, tc.expected, u.hugePageSize())
+		})
+	}
+}
+
+func TestHypervisorConfig(t *testing.T) {
+	const mib = 1024 * 1024
+	defer config.Set(config.Get())
+	defer withHostCPUs(4)()
+	seccomp := false
+	c := config.Default()
+	c.Hypervisors["qemu"] = config.Hypervisor{DefaultMemory: "512M", DefaultVCPUs: 2, Seccomp: &seccomp}
+	config.Set(c)
+
+	limit := int64(128 * mib)
+	newUnikontainer := func(hypervisor string, memory *specs.LinuxMemory, annotations map[string]string) *Unikontainer {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[annotHypervisor] = hypervisor
+		return &Unikontainer{
+			State: &specs.State{ID: "test", Annotations: annotations},
+			Spec: &specs.Spec{
+				Linux: &specs.Linux{
+					Resources: &specs.LinuxResources{Memory: memory},
+				},
+			},
+		}
+	}
+
+	// The defaults of the configuration
+	u := newUnikontainer("qemu", nil, nil)
+	assert.Equal(t, uint(2), u.vcpus())
+	assert.Equal(t, uint64(512*mib), u.guestMemory(0))
+	assert.False(t, u.withSeccomp())
+
+	// The resources of the container and the annotations override them
+	u = newUnikontainer("qemu", &specs.LinuxMemory{Limit: &limit}, map[string]string{annotVCPUs: "4", annotSeccomp: "true"})
+	assert.Equal(t, uint(4), u.vcpus())
+	assert.Equal(t, uint64(128*mib), u.guestMemory(0))
+	assert.True(t, u.withSeccomp())
+	u = newUnikontainer("qemu", nil, map[string]string{annotMemory: "1G", annotSeccomp: "maybe"})
+	assert.Equal(t, uint64(1024*mib), u.guestMemory(0))
+	assert.False(t, u.withSeccomp())
+	u = newUnikontainer("qemu", nil, map[string]string{annotMemory: "lots"})
+	assert.Equal(t, uint64(512*mib), u.guestMemory(0))
+
+	// Without a section, the defaults of urunc apply
+	u = newUnikontainer("hvt", nil, nil)
+	assert.Equal(t, hypervisors.DefaultVCPUs, u.vcpus())
+	assert.Zero(t, u.guestMemory(0))
+	assert.Equal(t, uint64(256*mib), u.guestMemory(2*mib))
+	assert.True(t, u.withSeccomp())
+
+	// The annotation can not disable the seccomp filters of the node
+	u = newUnikontainer("hvt", nil, map[string]string{annotSeccomp: "false"})
+	assert.True(t, u.withSeccomp())
+}
+
+func TestIsUnikernel(t *testing.T) {
+	writeBundle := func(t *testing.T, annotations map[string]string) string {
+		bundleDir := t.TempDir()
+		spec := &specs.Spec{
+			Version:     "1.2.1",
+			Root:        &specs.Root{Path: "rootfs"},
+			Annotations: annotations,
+		}
+		data, err := json.Marshal(spec)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(bundleDir, configFilename), data, 0o644))
+		return bundleDir
+	}
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	assert.False(t, IsUnikernel(t.TempDir()))
+	assert.False(t, IsUnikernel(writeBundle(t, nil)))
+	assert.True(t, IsUnikernel(writeBundle(t, map[string]string{
+		annotType:       encode("rumprun"),
+		annotHypervisor: encode("hvt"),
+	})))
+	// The config of the unikernel can also be in the rootfs
+	bundleDir := writeBundle(t, nil)
+	assert.NoError(t, os.MkdirAll(filepath.Join(bundleDir, "rootfs"), 0o755))
+	err := os.WriteFile(filepath.Join(bundleDir, "rootfs", uruncJSONFilename),
+		[]byte(`{"com.urunc.unikernel.unikernelType": "`+encode("unikraft")+`"}`), 0o644)
+	assert.NoError(t, err)
+	assert.True(t, IsUnikernel(bundleDir))
+	// Queue proxy containers get handled by runc
+	assert.False(t, IsUnikernel(writeBundle(t, map[string]string{
+		"io.kubernetes.cri.container-name": "queue-proxy",
+		annotType:                          encode("rumprun"),
+	})))
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urunc-dev/urunc/pkg/unikontainers/hypervisors"
+)
+
+// The default period of the CFS bandwidth control in microseconds
+const defaultCPUPeriod uint64 = 100000
+
+// ErrNoBalloon is returned when the memory limit of a running unikontainer
+// changes, but its VM has no balloon device to give the memory back
+var ErrNoBalloon = errors.New("the VM has no balloon device")
+
+// resources returns the current resources of the container
+func (u *Unikontainer) resources() *specs.LinuxResources {
+	if u.Resources != nil {
+		return u.Resources
+	}
+	if u.Spec.Linux != nil {
+		return u.Spec.Linux.Resources
+	}
+	return nil
+}
+
+// Update changes the CPU, memory and pids limits of a unikontainer. Only
+// the limits which are set in resources change. The new limits apply to the
+// cgroup of the monitor and the memory of the guest follows the memory
+// limit through its balloon device, up to the memory it booted with. The
+// new resources get stored in the state.
+func (u *Unikontainer) Update(resources *specs.LinuxResources) error {
+	status := u.Status()
+	if status != specs.StateCreated && status != specs.StateRunning && status != StatePaused {
+		return fmt.Errorf("cannot update unikontainer %s in state %s", u.State.ID, status)
+	}
+	current := u.resources()
+	updated := mergeResources(current, resources)
+	err := u.validateUpdate(status, current, updated)
+	if err != nil {
+		return err
+	}
+
+	// Shrink the guest before the cgroup, so the monitor does not exceed
+	// the new limit, and grow it after the cgroup allows it.
+	oldLimit, newLimit := memoryLimit(current), memoryLimit(updated)
+	resizeGuest := status != specs.StateCreated && oldLimit != newLimit
+	shrink := newLimit > 0 && (oldLimit <= 0 || newLimit < oldLimit)
+	if resizeGuest && shrink {
+		u.resizeGuestMemory(newLimit)
+	}
+	err = u.updateCgroup(updated)
+	if err != nil {
+		return err
+	}
+	if resizeGuest && !shrink {
+		u.resizeGuestMemory(newLimit)
+	}
+
+	u.Resources = updated
+	return u.saveContainerState()
+}
+
+// validateUpdate checks that the unikontainer can follow the updated
+// resources. The monitor and the vCPUs are pinned to the cpuset, which can
+// not change, and the guest memory can follow the memory limit only through
+// a balloon device.
+func (u *Unikontainer) validateUpdate(status specs.ContainerState, current *specs.LinuxResources, updated *specs.LinuxResources) error {
+	if cpusetOf(current) != cpusetOf(updated) {
+		return fmt.Errorf("cannot change the cpuset of unikontainer %s, since its monitor is pinned to it", u.State.ID)
+	}
+	if status != specs.StateCreated && memoryLimit(current) != memoryLimit(updated) && !u.withBalloon() {
+		return fmt.Errorf("cannot change the memory limit of unikontainer %s: %w (see the %s annotation)", u.State.ID, ErrNoBalloon, annotBalloon)
+	}
+	return nil
+}
+
+// resizeGuestMemory sets the memory of the guest to the given limit, or to
+// the memory it booted with, if the limit is larger or there is no limit.
+// Since the guest memory is a best effort, any failure is only logged.
+func (u *Unikontainer) resizeGuestMemory(limit int64) {
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to resize the guest memory")
+		return
+	}
+	resizer, ok := vmm.(hypervisors.MemoryResizer)
+	if !ok {
+		uniklog.WithField("vmm", vmmType).Warn("the vmm can not resize the guest memory")
+		return
+	}
+
+	args := u.controlArgs()
+	size := args.MemSizeB
+	if size == 0 {
+		size = hypervisors.DefaultMemory * 1024 * 1024
+	}
+	if limit > 0 && uint64(limit) < size {
+		size = uint64(limit)
+	}
+	err = resizer.ResizeMemory(args, size)
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to resize the guest memory")
+		return
+	}
+	uniklog.WithField("size", size).Debug("Resized the guest memory")
+}
+
+// cpusetOf returns the cpuset of the given resources, or "" if there is none
+func cpusetOf(resources *specs.LinuxResources) string {
+	if resources == nil || resources.CPU == nil {
+		return ""
+	}
+	return resources.CPU.Cpus
+}
+
+// memoryLimit returns the memory limit of the given resources, or 0 if
+// there is no limit
+func memoryLimit(resources *specs.LinuxResources) int64 {
+	if resources == nil || resources.Memory == nil || resources.Memory.Limit == nil {
+		return 0
+	}
+	if *resources.Memory.Limit < 0 {
+		return 0
+	}
+	return *resources.Memory.Limit
+}
+
+// mergeResources returns a copy of current, with the CPU, memory and pids
+// limits that are set in update replaced.
+func mergeResources(current *specs.LinuxResources, update *specs.LinuxResources) *specs.LinuxResources {
+	merged := &specs.LinuxResources{}
+	if current != nil {
+		*merged = *current
+	}
+	if update == nil {
+		return merged
+	}
+
+	if update.Memory != nil {
+		memory := specs.LinuxMemory{}
+		if merged.Memory != nil {
+			memory = *merged.Memory
+		}
+		if update.Memory.Limit != nil {
+			memory.Limit = update.Memory.Limit
+		}
+		if update.Memory.Reservation != nil {
+			memory.Reservation = update.Memory.Reservation
+		}
+		if update.Memory.Swap != nil {
+			memory.Swap = update.Memory.Swap
+		}
+		merged.Memory = &memory
+	}
+	if update.CPU != nil {
+		cpu := specs.LinuxCPU{}
+		if merged.CPU != nil {
+			cpu = *merged.CPU
+		}
+		if update.CPU.Shares != nil {
+			cpu.Shares = update.CPU.Shares
+		}
+		if update.CPU.Quota != nil {
+			cpu.Quota = update.CPU.Quota
+		}
+		if update.CPU.Period != nil {
+			cpu.Period = update.CPU.Period
+		}
+		if update.CPU.Cpus != "" {
+			cpu.Cpus = update.CPU.Cpus
+		}
+		if update.CPU.Mems != "" {
+			cpu.Mems = update.CPU.Mems
+		}
+		// cgroup v2 sets the quota along with the period
+		if cpu.Quota != nil && cpu.Period == nil {
+			period := defaultCPUPeriod
+			cpu.Period = &period
+		}
+		merged.CPU = &cpu
+	}
+	if update.Pids != nil {
+		pids := *update.Pids
+		merged.Pids = &pids
+	}
+	return merged
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeResources(t *testing.T) {
+	limit := int64(512 * 1024 * 1024)
+	newLimit := int64(256 * 1024 * 1024)
+	quota := int64(200000)
+	period := uint64(100000)
+	newQuota := int64(50000)
+	current := &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit},
+		CPU:    &specs.LinuxCPU{Quota: &quota, Period: &period, Cpus: "0-3"},
+		Pids:   &specs.LinuxPids{Limit: 32},
+	}
+
+	merged := mergeResources(current, &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &newLimit},
+		CPU:    &specs.LinuxCPU{Quota: &newQuota},
+	})
+	assert.Equal(t, newLimit, *merged.Memory.Limit)
+	assert.Equal(t, newQuota, *merged.CPU.Quota)
+	assert.Equal(t, period, *merged.CPU.Period)
+	assert.Equal(t, "0-3", merged.CPU.Cpus)
+	assert.Equal(t, int64(32), merged.Pids.Limit)
+	// The current resources do not change
+	assert.Equal(t, limit, *current.Memory.Limit)
+	assert.Equal(t, quota, *current.CPU.Quota)
+
+	// Without a period, the quota gets the default period
+	merged = mergeResources(nil, &specs.LinuxResources{
+		CPU:  &specs.LinuxCPU{Quota: &newQuota},
+		Pids: &specs.LinuxPids{Limit: 64},
+	})
+	assert.Equal(t, defaultCPUPeriod, *merged.CPU.Period)
+	assert.Equal(t, int64(64), merged.Pids.Limit)
+	assert.Nil(t, merged.Memory)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	limit := int64(256 * 1024 * 1024)
+	unlimited := int64(-1)
+	assert.Equal(t, int64(0), memoryLimit(nil))
+	assert.Equal(t, int64(0), memoryLimit(&specs.LinuxResources{}))
+	assert.Equal(t, int64(0), memoryLimit(&specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &unlimited}}))
+	assert.Equal(t, limit, memoryLimit(&specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &limit}}))
+}
+
+func TestValidateUpdate(t *testing.T) {
+	limit := int64(512 * 1024 * 1024)
+	newLimit := int64(256 * 1024 * 1024)
+	current := &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit},
+		CPU:    &specs.LinuxCPU{Cpus: "0-3"},
+	}
+	u := &Unikontainer{
+		State: &specs.State{ID: "test", Annotations: map[string]string{}},
+		Spec:  &specs.Spec{},
+	}
+
+	// The pids limit can always change
+	pids := mergeResources(current, &specs.LinuxResources{Pids: &specs.LinuxPids{Limit: 64}})
+	assert.NoError(t, u.validateUpdate(specs.StateRunning, current, pids))
+
+	// The cpuset can never change
+	cpuset := mergeResources(current, &specs.LinuxResources{CPU: &specs.LinuxCPU{Cpus: "0-1"}})
+	assert.Error(t, u.validateUpdate(specs.StateCreated, current, cpuset))
+	unchanged := mergeResources(current, &specs.LinuxResources{CPU: &specs.LinuxCPU{Cpus: "0-3"}})
+	assert.NoError(t, u.validateUpdate(specs.StateRunning, current, unchanged))
+
+	// The memory limit of a running VM needs a balloon device
+	memory := mergeResources(current, &specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &newLimit}})
+	assert.NoError(t, u.validateUpdate(specs.StateCreated, current, memory))
+	assert.ErrorIs(t, u.validateUpdate(specs.StateRunning, current, memory), ErrNoBalloon)
+	u.State.Annotations[annotBalloon] = "true"
+	assert.NoError(t, u.validateUpdate(specs.StateRunning, current, memory))
+}
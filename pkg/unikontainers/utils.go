@@ -24,13 +24,15 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
 	"github.com/opencontainers/runtime-spec/specs-go"
-	"github.com/urunc-dev/urunc/internal/constants"
+	"github.com/urunc-dev/urunc/internal/config"
 )
 
 const (
 	configFilename    = "config.json"
 	stateFilename     = "state.json"
+	exitFilename      = "exit.json"
 	initPidFilename   = "init.pid"
 	uruncJSONFilename = "urunc.json"
 	rootfsDirName     = "rootfs"
@@ -138,21 +140,27 @@ func writePidFile(path string, pid int) error {
 	return os.Rename(tmpName, path)
 }
 
-// handleQueueProxy adds a hardcoded IP to the process's environment.
+// handleQueueProxy adds the IP of the first TAP device of the dynamic network
+// to the process's environment.
 // Then, the container is identified as a non-bima container
 // is spawned using runc.
 func handleQueueProxy(spec specs.Spec, configFile string) error {
+	redirectAddr, err := config.Get().Network.DynamicTapAddr(0)
+	if err != nil {
+		return err
+	}
+	redirectIP := redirectAddr.Addr().String()
 	var readinessProbeEnv string
 	for i, envVar := range spec.Process.Env {
 		if strings.HasPrefix(envVar, "SERVING_READINESS_PROBE") {
 			spec.Process.Env = remove(spec.Process.Env, i)
 			re := regexp.MustCompile(`"host"\s*:\s*"[^"]+"`)
-			readinessProbeEnv = re.ReplaceAllString(envVar, `"host":"`+constants.QueueProxyRedirectIP+`"`)
+			readinessProbeEnv = re.ReplaceAllString(envVar, `"host":"`+redirectIP+`"`)
 			break
 		}
 	}
 
-	redirectIPEnv := fmt.Sprintf("REDIRECT_IP=%s", constants.QueueProxyRedirectIP)
+	redirectIPEnv := fmt.Sprintf("REDIRECT_IP=%s", redirectIP)
 	envs := []string{readinessProbeEnv, redirectIPEnv}
 	spec.Process.Env = append(spec.Process.Env, envs...)
 
@@ -197,6 +205,56 @@ func checkValidNsPath(path string) error {
 	return nil
 }
 
+// parseCPUList parses a list of CPUs in the format of cpusets (e.g. "0-3,6")
+// and returns the CPUs in it.
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid cpu list %q", list)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid cpu list %q", list)
+			}
+		}
+		for c := start; c <= end; c++ {
+			if !seen[c] {
+				seen[c] = true
+				cpus = append(cpus, c)
+			}
+		}
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("empty cpu list %q", list)
+	}
+	return cpus, nil
+}
+
+// parseHugePageSize parses the size of a hugepage, as found in the hugepage
+// limits of the OCI spec (e.g. "2MB", "1GB"). The unit can also be K, M or G,
+// with or without a B or iB suffix.
+func parseHugePageSize(size string) (uint64, error) {
+	value := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(size), "iB"), "B")
+	// Unlike other sizes, the unit of a hugepage size is mandatory
+	if value == "" || !strings.ContainsRune("KkMmGg", rune(value[len(value)-1])) {
+		return 0, fmt.Errorf("invalid hugepage size %q", size)
+	}
+	n, err := units.RAMInBytes(strings.TrimSpace(size))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid hugepage size %q", size)
+	}
+	return uint64(n), nil
+}
+
 func convertUint32ToIntSlice(valSlice []uint32, size int) []int {
 	retSlice := make([]int, size)
 	for i, val := range valSlice {
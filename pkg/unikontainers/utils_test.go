@@ -364,3 +364,38 @@ func TestLoadSpec(t *testing.T) {
 		assert.Contains(t, err.Error(), "failed to parse specification json", "Expected specific error message")
 	})
 }
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := parseCPUList("0-2,5,7-8")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 5, 7, 8}, cpus)
+
+	cpus, err = parseCPUList("3,3,2-3\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 2}, cpus)
+
+	for _, invalid := range []string{"", "a", "3-1", "-1", "1-"} {
+		_, err = parseCPUList(invalid)
+		assert.Error(t, err, "expected an error for %q", invalid)
+	}
+}
+
+func TestParseHugePageSize(t *testing.T) {
+	const mib = 1024 * 1024
+	for input, expected := range map[string]uint64{
+		"2MB":  2 * mib,
+		"2M":   2 * mib,
+		"1GB":  1024 * mib,
+		"1GiB": 1024 * mib,
+		"64KB": 64 * 1024,
+	} {
+		size, err := parseHugePageSize(input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, size, "unexpected size for %q", input)
+	}
+
+	for _, invalid := range []string{"", "MB", "0MB", "2", "2TB", "x2MB"} {
+		_, err := parseHugePageSize(invalid)
+		assert.Error(t, err, "expected an error for %q", invalid)
+	}
+}